@@ -0,0 +1,253 @@
+package brands
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	archiveIDLayout       = "20060102T150405.000Z"
+	archivedOverridesName = "uuid-overrides.json.gz"
+	archivedResumedName   = "resumed"
+)
+
+var archiveIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{3}Z$`)
+
+// errArchiveResumed - a resumed reload only archives the TME pages after its checkpoint, so replaying it would lose the rest
+var errArchiveResumed = errors.New("Archive is of a reload resumed from a checkpoint, it lacks the TME pages fetched before")
+
+// PayloadArchive - keeps the raw TME pages and Bertha payload of each reload, gzipped, in a directory per reload
+// so a reload can be audited or replayed. Only the most recent retention archives are kept, or all of them for a
+// retention of zero. A nil archive is disabled.
+type PayloadArchive struct {
+	sync.Mutex
+	dir       string
+	retention int
+	current   string
+	pages     map[string]int
+}
+
+// NewPayloadArchive - create a PayloadArchive in dir, or nil if dir is empty
+func NewPayloadArchive(dir string, retention int) *PayloadArchive {
+	if dir == "" {
+		return nil
+	}
+	return &PayloadArchive{dir: dir, retention: retention}
+}
+
+// begin - start a new archive that following payloads are recorded to, returning its id
+func (a *PayloadArchive) begin() (string, error) {
+	if a == nil {
+		return "", nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	id := time.Now().UTC().Format(archiveIDLayout)
+	if err := os.MkdirAll(filepath.Join(a.dir, id), 0700); err != nil {
+		return "", err
+	}
+	a.current = id
+	a.pages = make(map[string]int)
+	log.Infof("Archiving reload payloads to [%s]", filepath.Join(a.dir, id))
+	return id, nil
+}
+
+// finish - stop recording to the current archive and remove archives beyond the retention, if there is one
+func (a *PayloadArchive) finish() {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.current = ""
+
+	ids, err := a.archiveIDs()
+	if err != nil {
+		log.Warnf("Cannot list payload archives in [%s]: %v", a.dir, err)
+		return
+	}
+	for a.retention > 0 && len(ids) > a.retention {
+		if err := os.RemoveAll(filepath.Join(a.dir, ids[0])); err != nil {
+			log.Warnf("Cannot remove payload archive [%s]: %v", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+}
+
+// recordTmePage - archive a raw page of a TME taxonomy
+func (a *PayloadArchive) recordTmePage(taxonomyName string, contents []byte) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.current == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(a.dir, a.current, taxonomyName), 0700); err != nil {
+		log.Warnf("Cannot archive TME page of %s: %v", taxonomyName, err)
+		return
+	}
+	name := filepath.Join(a.dir, a.current, taxonomyName, fmt.Sprintf("%05d.xml.gz", a.pages[taxonomyName]))
+	a.pages[taxonomyName]++
+	if err := writeGzipped(name, contents); err != nil {
+		log.Warnf("Cannot archive TME page of %s: %v", taxonomyName, err)
+	}
+}
+
+// recordBertha - archive the raw Bertha payload, in the format (json or csv) it was read in
+func (a *PayloadArchive) recordBertha(format string, contents []byte) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.current == "" {
+		return
+	}
+	if err := writeGzipped(filepath.Join(a.dir, a.current, "bertha."+format+".gz"), contents); err != nil {
+		log.Warnf("Cannot archive Bertha payload: %v", err)
+	}
+}
+
+// recordUUIDOverrides - archive the UUID overrides the reload used, so a replay gives the brands the same UUIDs
+func (a *PayloadArchive) recordUUIDOverrides(overrides map[string]string) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.current == "" {
+		return
+	}
+	contents, err := json.Marshal(overrides)
+	if err == nil {
+		err = writeGzipped(filepath.Join(a.dir, a.current, archivedOverridesName), contents)
+	}
+	if err != nil {
+		log.Warnf("Cannot archive UUID overrides: %v", err)
+	}
+}
+
+// recordResumed - mark the current archive as that of a reload resumed from the checkpoint, which cannot be replayed
+func (a *PayloadArchive) recordResumed(checkpoint reloadCheckpoint) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.current == "" {
+		return
+	}
+	contents := fmt.Sprintf("%s %d\n", checkpoint.Taxonomy, checkpoint.Offset)
+	if err := ioutil.WriteFile(filepath.Join(a.dir, a.current, archivedResumedName), []byte(contents), 0600); err != nil {
+		log.Warnf("Cannot mark the archive as resumed: %v", err)
+	}
+}
+
+// path - the directory of an archive, which can be read by a fileTmeRepository
+func (a *PayloadArchive) path(id string) (string, error) {
+	if a == nil {
+		return "", errors.New("Payload archiving is not enabled")
+	}
+	if !archiveIDPattern.MatchString(id) {
+		return "", fmt.Errorf("Invalid archive id [%s]", id)
+	}
+	path := filepath.Join(a.dir, id)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("Archive [%s] not found", id)
+	}
+	return path, nil
+}
+
+// berthaSource - the archived Bertha payload of an archive
+func (a *PayloadArchive) berthaSource(id string) (string, error) {
+	path, err := a.path(id)
+	if err != nil {
+		return "", err
+	}
+	files, err := filepath.Glob(filepath.Join(path, "bertha.*.gz"))
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("Archive [%s] has no Bertha payload", id)
+	}
+	return files[0], nil
+}
+
+// uuidOverridesSource - the archived UUID overrides of an archive
+func (a *PayloadArchive) uuidOverridesSource(id string) (string, error) {
+	path, err := a.path(id)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(path, archivedOverridesName)
+	if _, err := os.Stat(name); err != nil {
+		return "", fmt.Errorf("Archive [%s] has no UUID overrides", id)
+	}
+	return name, nil
+}
+
+// resumed - whether an archive is of a reload resumed from a checkpoint
+func (a *PayloadArchive) resumed(id string) (bool, error) {
+	path, err := a.path(id)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(filepath.Join(path, archivedResumedName))
+	return err == nil, nil
+}
+
+func (a *PayloadArchive) archiveIDs() ([]string, error) {
+	entries, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() && archiveIDPattern.MatchString(entry.Name()) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func writeGzipped(name string, contents []byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(contents); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func readGzipped(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
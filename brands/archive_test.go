@@ -0,0 +1,113 @@
+package brands
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayArchivedReload(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	dumpDir, err := ioutil.TempDir("", "tme")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dumpDir)
+	archiveDir, err := ioutil.TempDir("", "archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(archiveDir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dumpDir, "Brands"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dumpDir, "Brands", "0.xml"), []byte(firstDump), 0600))
+	overridesFile := filepath.Join(dumpDir, "overrides.json")
+	assert.NoError(t, ioutil.WriteFile(overridesFile, []byte(`{}`), 0600))
+
+	archive := NewPayloadArchive(archiveDir, 1)
+	repo := NewFileTmeRepository(dumpDir, "Brands", 10, NewArchivingBrandTransformer(archive, "Brands"))
+	client := mockClient{resp: []berthaBrand{testBerthaBrand}}
+	service := createTestBrandService(repo, tmpfile.Name(), func(c *ServiceConfig) { c.MaxTmeRecords = 10 }, func(c *ServiceConfig) { c.Archive = archive }, func(c *ServiceConfig) { c.UUIDOverridesSource = overridesFile }, withHTTPClient(&client))
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+	assertCount(t, service, 3)
+
+	ids, err := archive.archiveIDs()
+	assert.NoError(t, err)
+	assert.Len(t, ids, 1)
+	assert.NoError(t, service.canReplay(ids[0]))
+	page, err := readGzipped(filepath.Join(archiveDir, ids[0], "Brands", "00000.xml.gz"))
+	assert.NoError(t, err)
+	assert.Equal(t, firstDump, string(page))
+	contents, err := readGzipped(filepath.Join(archiveDir, ids[0], archivedOverridesName))
+	assert.NoError(t, err)
+	var overrides map[string]string
+	assert.NoError(t, json.Unmarshal(contents, &overrides))
+	assert.Equal(t, berthaUUIDmap(), overrides, "The built-in overrides are archived with the loaded ones")
+
+	assert.NoError(t, os.RemoveAll(dumpDir), "The replay uses the archived overrides rather than the live source")
+	client.err = os.ErrNotExist
+	assert.NoError(t, service.replayDB(context.Background(), ids[0], reloadTrigger{}))
+	waitTillDataLoaded(t, service)
+	assertCount(t, service, 3)
+	_, found, err := service.getBrandByUUID(context.Background(), expectedBrand.UUID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	time.Sleep(2 * time.Millisecond)
+	assert.Error(t, service.reloadDB(context.Background(), reloadTrigger{}))
+	newIds, err := archive.archiveIDs()
+	assert.NoError(t, err)
+	assert.Len(t, newIds, 1)
+	assert.NotEqual(t, ids[0], newIds[0])
+}
+
+func TestCanReplayUnknownArchive(t *testing.T) {
+	archiveDir, err := ioutil.TempDir("", "archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(archiveDir)
+
+	s := &brandServiceImpl{archive: NewPayloadArchive(archiveDir, 1)}
+	assert.Error(t, s.canReplay("20161018T155800.000Z"))
+	assert.Error(t, s.canReplay("../../etc"))
+
+	s = &brandServiceImpl{archive: NewPayloadArchive("", 1)}
+	assert.Error(t, s.canReplay("20161018T155800.000Z"))
+}
+
+func TestArchiveRetention(t *testing.T) {
+	for retention, kept := range map[int]int{0: 3, 1: 1, 2: 2} {
+		archiveDir, err := ioutil.TempDir("", "archive")
+		assert.NoError(t, err)
+		archive := NewPayloadArchive(archiveDir, retention)
+		for i := 0; i < 3; i++ {
+			_, err := archive.begin()
+			assert.NoError(t, err)
+			archive.finish()
+			time.Sleep(2 * time.Millisecond)
+		}
+		ids, err := archive.archiveIDs()
+		assert.NoError(t, err)
+		assert.Len(t, ids, kept, "retention %d", retention)
+		os.RemoveAll(archiveDir)
+	}
+}
+
+func TestCannotReplayResumedReload(t *testing.T) {
+	archiveDir, err := ioutil.TempDir("", "archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(archiveDir)
+	archive := NewPayloadArchive(archiveDir, 1)
+	id, err := archive.begin()
+	assert.NoError(t, err)
+	archive.recordBertha("json", []byte(`[]`))
+	archive.recordUUIDOverrides(berthaUUIDmap())
+	archive.recordResumed(reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 10})
+	archive.finish()
+
+	s := &brandServiceImpl{archive: archive}
+	assert.Equal(t, errArchiveResumed, s.canReplay(id))
+	assert.Equal(t, errArchiveResumed, s.replay(context.Background(), id, reloadTrigger{}))
+}
@@ -0,0 +1,161 @@
+package brands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+const (
+	auditBucket           = "audit"
+	auditRetention        = 500
+	accessDeniedBucket    = "access-denied"
+	accessDeniedRetention = 1000
+	auditKeyLayout        = "2006-01-02T15:04:05.000000000Z"
+
+	defaultAuditLimit = 20
+
+	startupTrigger = "startup"
+	requestTrigger = "request"
+)
+
+// reloadTrigger - what started a reload, and on whose behalf
+type reloadTrigger struct {
+	Source        string
+	Caller        string
+	TransactionID string
+}
+
+func newStartupTrigger() reloadTrigger {
+	return reloadTrigger{Source: startupTrigger, TransactionID: transactionidutils.NewTransactionID()}
+}
+
+func newRequestTrigger(req *http.Request) reloadTrigger {
+	caller := clientAddress(req)
+	if p, found := req.Context().Value(principalKey{}).(principal); found {
+		caller = p.Name + " (" + caller + ")"
+	}
+	return reloadTrigger{Source: requestTrigger, Caller: caller, TransactionID: transactionidutils.GetTransactionIDFromRequest(req)}
+}
+
+type reloadCounts struct {
+	TmeBrands         int `json:"tmeBrands"`
+	BerthaRows        int `json:"berthaRows"`
+	CuratedBrands     int `json:"curatedBrands"`
+	CuratedOnlyBrands int `json:"curatedOnlyBrands"`
+	SkippedBerthaRows int `json:"skippedBerthaRows"`
+	InvalidBrands     int `json:"invalidBrands"`
+	Brands            int `json:"brands"`
+	UncuratedBrands   int `json:"uncuratedBrands"`
+}
+
+type brandWarning struct {
+	UUID          string `json:"uuid,omitempty"`
+	PrefLabel     string `json:"prefLabel"`
+	TmeIdentifier string `json:"tmeIdentifier,omitempty"`
+	Message       string `json:"message"`
+}
+
+// auditReload - log the finished reload as a JSON record and keep it in the cache file, dropping the oldest records beyond the retention
+func (s *brandServiceImpl) auditReload(record reloadResult) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("Cannot marshal reload audit record: %v", err.Error())
+		return
+	}
+	log.Infof("Reload audit: %s", value)
+	s.putAuditRecord(auditBucket, auditRetention, record.started, value)
+}
+
+// auditAccessDenied - log the denied request as a JSON record and keep it in the cache file, in a bucket of its own so
+// that a flood of denied requests cannot push the reload records out
+func (s *brandServiceImpl) auditAccessDenied(record accessDenied) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("Cannot marshal access denied audit record: %v", err.Error())
+		return
+	}
+	log.Infof("Access denied audit: %s", value)
+	s.putAuditRecord(accessDeniedBucket, accessDeniedRetention, time.Now().UTC(), value)
+}
+
+func (s *brandServiceImpl) putAuditRecord(name string, retention int, at time.Time, value []byte) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.db == nil {
+		return
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(name))
+		if bucket == nil {
+			return fmt.Errorf("Cache bucket [%v] not found!", name)
+		}
+		if err := bucket.Put([]byte(at.Format(auditKeyLayout)), value); err != nil {
+			return err
+		}
+		var keys [][]byte
+		bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			return nil
+		})
+		for len(keys) > retention {
+			if err := bucket.Delete(keys[0]); err != nil {
+				return err
+			}
+			keys = keys[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Cannot store audit record: %v", err.Error())
+	}
+}
+
+// getAuditRecords - the most recent reload and access denied audit records, newest first
+func (s *brandServiceImpl) getAuditRecords(ctx context.Context, limit int) ([]json.RawMessage, error) {
+	s.RLock()
+	defer s.RUnlock()
+	records := []json.RawMessage{}
+	if s.db == nil {
+		return records, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_, span := startSpan(ctx, "cache.read", cacheQueryAttribute.String("audit"))
+	defer span.End()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var cursors []*bolt.Cursor
+		var keys, values [][]byte
+		for _, name := range []string{auditBucket, accessDeniedBucket} {
+			if bucket := tx.Bucket([]byte(name)); bucket != nil {
+				c := bucket.Cursor()
+				k, v := c.Last()
+				cursors, keys, values = append(cursors, c), append(keys, k), append(values, v)
+			}
+		}
+		for len(records) < limit {
+			newest := -1
+			for i, k := range keys {
+				if k != nil && (newest < 0 || bytes.Compare(k, keys[newest]) > 0) {
+					newest = i
+				}
+			}
+			if newest < 0 {
+				break
+			}
+			records = append(records, json.RawMessage(append([]byte{}, values[newest]...)))
+			keys[newest], values[newest] = cursors[newest].Prev()
+		}
+		return nil
+	})
+	return records, err
+}
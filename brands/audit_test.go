@@ -0,0 +1,106 @@
+package brands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadIsAudited(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "FT Data", RawID: "0f6e4716-b2b5-485a-9da9-76e777a719f2"}}}
+	client := mockClient{resp: []berthaBrand{testBerthaBrandFixedUUID, testBerthaBrand, {PrefLabel: "No TME identifier"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&client))
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	repo.count = 0
+	assert.NoError(t, service.reloadDB(context.Background(), reloadTrigger{Source: requestTrigger, Caller: "10.0.0.1:1234", TransactionID: "tid_reload"}))
+
+	records, err := service.getAuditRecords(context.Background(), defaultAuditLimit)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	var latest, first reloadResult
+	assert.NoError(t, json.Unmarshal(records[0], &latest))
+	assert.NoError(t, json.Unmarshal(records[1], &first))
+	assert.Equal(t, startupTrigger, first.Trigger)
+	assert.NotEmpty(t, first.TransactionID)
+	assert.Equal(t, requestTrigger, latest.Trigger)
+	assert.Equal(t, "10.0.0.1:1234", latest.Caller)
+	assert.Equal(t, "tid_reload", latest.TransactionID)
+	assert.Equal(t, reloadSucceeded, latest.Status)
+	assert.Equal(t, reloadCounts{TmeBrands: 2, BerthaRows: 3, CuratedBrands: 1, CuratedOnlyBrands: 1, SkippedBerthaRows: 1, Brands: 3, UncuratedBrands: 1}, latest.Counts)
+	assert.Equal(t, []brandWarning{
+		{UUID: expectedBrand.UUID, PrefLabel: "Financial Times", TmeIdentifier: "1234567890", Message: "Curated brand was not found in cache, adding without V1 information"},
+		{PrefLabel: "No TME identifier", Message: "No TME Identifier, ignoring curated brand"},
+	}, latest.Warnings)
+
+	records, err = service.getAuditRecords(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+var errBerthaFail = errors.New("bertha fail")
+
+func TestFailedReloadIsAudited(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&mockClient{err: errBerthaFail}))
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	records, err := service.getAuditRecords(context.Background(), defaultAuditLimit)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	var record reloadResult
+	assert.NoError(t, json.Unmarshal(records[0], &record))
+	assert.Equal(t, reloadFailed, record.Status)
+	assert.Equal(t, 1, record.Counts.TmeBrands)
+	assert.Equal(t, []string{errBerthaFail.Error()}, record.Errors)
+}
+
+func TestAccessDeniedIsAudited(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	service.auditAccessDenied(accessDenied{Event: accessDeniedEvent, TransactionID: "tid_denied", Caller: "10.0.0.1:1234", Method: "POST", Path: "/transformers/brands/__reload", Reason: "No credentials"})
+
+	records, err := service.getAuditRecords(context.Background(), defaultAuditLimit)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	var denied accessDenied
+	assert.NoError(t, json.Unmarshal(records[0], &denied))
+	assert.Equal(t, "tid_denied", denied.TransactionID)
+	assert.Equal(t, "No credentials", denied.Reason)
+}
+
+func TestAccessDeniedKeepsItsOwnRetention(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	for i := 0; i < accessDeniedRetention+10; i++ {
+		service.auditAccessDenied(accessDenied{Event: accessDeniedEvent, Reason: "No credentials"})
+	}
+
+	records, err := service.getAuditRecords(context.Background(), accessDeniedRetention+10)
+	assert.NoError(t, err)
+	assert.Len(t, records, accessDeniedRetention+1, "The denials are trimmed on their own, the reload is kept")
+	var reload reloadResult
+	assert.NoError(t, json.Unmarshal(records[len(records)-1], &reload))
+	assert.Equal(t, startupTrigger, reload.Trigger)
+}
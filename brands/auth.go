@@ -0,0 +1,177 @@
+package brands
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+	log "github.com/Sirupsen/logrus"
+)
+
+// AdminRole - the role needed to call the admin endpoints, such as reload
+const AdminRole = "admin"
+
+const accessDeniedEvent = "access-denied"
+
+type principalKey struct{}
+
+type principal struct {
+	Name  string
+	Roles []string
+}
+
+func (p principal) hasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator - identifies callers by a static API key (X-Api-Key header) or an HMAC signed bearer token, and the roles they have
+type Authenticator struct {
+	keys       map[string]principal
+	hmacSecret []byte
+}
+
+// NewAuthenticator - create an Authenticator from API keys given as name:key:role1|role2 and the secret HMAC tokens are signed with.
+// Without any keys or secret there is nothing to authenticate against, which is an error rather than leaving the admin endpoints open.
+func NewAuthenticator(apiKeys []string, hmacSecret string) (*Authenticator, error) {
+	if len(apiKeys) == 0 && hmacSecret == "" {
+		return nil, errors.New("No API keys or token secret configured, the admin endpoints would be open to everyone")
+	}
+	a := &Authenticator{keys: make(map[string]principal), hmacSecret: []byte(hmacSecret)}
+	for i, apiKey := range apiKeys {
+		parts := strings.SplitN(apiKey, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid API key number %d, expected name:key:roles", i+1)
+		}
+		a.keys[hashKey(parts[1])] = principal{Name: parts[0], Roles: strings.Split(parts[2], "|")}
+	}
+	return a, nil
+}
+
+// SignToken - create a bearer token for name with the roles, valid until expiry
+func SignToken(hmacSecret string, name string, roles []string, expiry time.Time) (string, error) {
+	payload, err := json.Marshal(tokenClaims{Subject: name, Roles: roles, Expiry: expiry.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(hmacSecret), encoded)), nil
+}
+
+type tokenClaims struct {
+	Subject string   `json:"sub"`
+	Roles   []string `json:"roles"`
+	Expiry  int64    `json:"exp"`
+}
+
+func (a *Authenticator) authenticate(req *http.Request) (principal, error) {
+	if key := req.Header.Get("X-Api-Key"); key != "" {
+		if p, found := a.keys[hashKey(key)]; found {
+			return p, nil
+		}
+		return principal{}, errors.New("Unknown API key")
+	}
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return principal{}, errors.New("No credentials")
+	}
+	if len(a.hmacSecret) == 0 {
+		return principal{}, errors.New("Bearer tokens are not accepted")
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 2 {
+		return principal{}, errors.New("Malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(a.hmacSecret, parts[0])) {
+		return principal{}, errors.New("Invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return principal{}, errors.New("Malformed token")
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return principal{}, errors.New("Malformed token")
+	}
+	if time.Now().Unix() > claims.Expiry {
+		return principal{}, errors.New("Expired token")
+	}
+	return principal{Name: claims.Subject, Roles: claims.Roles}, nil
+}
+
+// RequireRole - only let callers with the role through to next. Denied attempts are audited. A nil Authenticator lets no one through.
+func (h *BrandHandler) RequireRole(a *Authenticator, role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if a == nil {
+			h.denyAccess(writer, req, "", "No credentials configured", http.StatusUnauthorized)
+			return
+		}
+		p, err := a.authenticate(req)
+		if err != nil {
+			h.denyAccess(writer, req, "", err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !p.hasRole(role) {
+			h.denyAccess(writer, req, p.Name, "Missing role "+role, http.StatusForbidden)
+			return
+		}
+		next(writer, req.WithContext(context.WithValue(req.Context(), principalKey{}, p)))
+	}
+}
+
+type accessDenied struct {
+	Event         string `json:"event"`
+	TransactionID string `json:"transactionId"`
+	Caller        string `json:"caller"`
+	Principal     string `json:"principal,omitempty"`
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	Reason        string `json:"reason"`
+	Time          string `json:"time"`
+}
+
+func (h *BrandHandler) denyAccess(writer http.ResponseWriter, req *http.Request, name string, reason string, statusCode int) {
+	denied := accessDenied{
+		Event:         accessDeniedEvent,
+		TransactionID: transactionidutils.GetTransactionIDFromRequest(req),
+		Caller:        clientAddress(req),
+		Principal:     name,
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Reason:        reason,
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	log.Warnf("Denied %s %s to %s: %s", req.Method, req.URL.Path, denied.Caller, reason)
+	h.service.auditAccessDenied(denied)
+
+	if statusCode == http.StatusUnauthorized {
+		writer.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeProblem(writer, req, statusCode, "")
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,129 @@
+package brands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTokenSecret = "t0k3n-s3cr3t"
+
+func TestNewAuthenticator(t *testing.T) {
+	_, err := NewAuthenticator(nil, "")
+	assert.Error(t, err, "Without credentials the admin endpoints would be open")
+
+	_, err = NewAuthenticator([]string{"ops:s3cr3t"}, "")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "s3cr3t")
+
+	auth, err := NewAuthenticator([]string{"ops:s3cr3t:admin|read"}, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, auth)
+}
+
+func TestReloadRequiresAdminRole(t *testing.T) {
+	auth, err := NewAuthenticator([]string{"ops:adm1n:admin", "dashboard:r3ad:read"}, testTokenSecret)
+	assert.NoError(t, err)
+	adminToken, _ := SignToken(testTokenSecret, "deploy", []string{AdminRole}, time.Now().Add(time.Hour))
+	expiredToken, _ := SignToken(testTokenSecret, "deploy", []string{AdminRole}, time.Now().Add(-time.Hour))
+	forgedToken, _ := SignToken("wrong secret", "deploy", []string{AdminRole}, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		statusCode int
+		reason     string
+	}{
+		{"NoCredentials", "", "", http.StatusUnauthorized, "No credentials"},
+		{"UnknownAPIKey", "X-Api-Key", "guess", http.StatusUnauthorized, "Unknown API key"},
+		{"APIKeyWithoutRole", "X-Api-Key", "r3ad", http.StatusForbidden, "Missing role admin"},
+		{"AdminAPIKey", "X-Api-Key", "adm1n", http.StatusAccepted, ""},
+		{"AdminToken", "Authorization", "Bearer " + adminToken, http.StatusAccepted, ""},
+		{"ExpiredToken", "Authorization", "Bearer " + expiredToken, http.StatusUnauthorized, "Expired token"},
+		{"ForgedToken", "Authorization", "Bearer " + forgedToken, http.StatusUnauthorized, "Invalid token signature"},
+		{"MalformedToken", "Authorization", "Bearer garbage", http.StatusUnauthorized, "Malformed token"},
+	}
+
+	for _, test := range tests {
+		var wg sync.WaitGroup
+		s := &dummyService{wg: &wg, initialised: true, dataLoaded: true}
+		if test.statusCode == http.StatusAccepted {
+			wg.Add(1)
+		}
+		req := newRequest("POST", "/transformers/brands/__reload")
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Del("X-Api-Key")
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		rec := httptest.NewRecorder()
+		newRouter(s, auth, nil).ServeHTTP(rec, req)
+		wg.Wait()
+
+		assert.Equal(t, test.statusCode, rec.Code, test.name)
+		if test.statusCode == http.StatusAccepted {
+			assert.True(t, s.loadDBCalled, test.name)
+			assert.Empty(t, s.denied, test.name)
+			continue
+		}
+		assert.False(t, s.loadDBCalled, test.name)
+		if assert.Len(t, s.denied, 1, test.name) {
+			assert.Equal(t, test.reason, s.denied[0].Reason, test.name)
+			assert.Equal(t, "10.0.0.1", s.denied[0].Caller, test.name)
+			assert.Equal(t, "/transformers/brands/__reload", s.denied[0].Path, test.name)
+		}
+	}
+}
+
+func TestReloadRecordsAuthenticatedCaller(t *testing.T) {
+	auth, _ := NewAuthenticator([]string{"ops:adm1n:admin"}, "")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s := &dummyService{wg: &wg, initialised: true, dataLoaded: true}
+	req := newRequest("POST", "/transformers/brands/__reload")
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Api-Key", "adm1n")
+	newRouter(s, auth, nil).ServeHTTP(httptest.NewRecorder(), req)
+	wg.Wait()
+	assert.Equal(t, "ops (10.0.0.1)", s.trigger.Caller)
+}
+
+func TestAdminEndpointsClosedWithoutAuthenticator(t *testing.T) {
+	s := &dummyService{initialised: true, dataLoaded: true}
+	for _, method := range []string{"POST", "DELETE"} {
+		rec := httptest.NewRecorder()
+		newRouter(s, nil, nil).ServeHTTP(rec, newRequest(method, "/transformers/brands/__reload"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, method)
+	}
+	assert.False(t, s.loadDBCalled)
+	assert.Len(t, s.denied, 2)
+}
+
+func TestReadEndpointsStayPublic(t *testing.T) {
+	auth, _ := NewAuthenticator([]string{"ops:adm1n:admin"}, "")
+	s := &dummyService{initialised: true, dataLoaded: true, count: 2}
+	for _, path := range []string{"/transformers/brands/__count", "/transformers/brands/__reload"} {
+		rec := httptest.NewRecorder()
+		newRouter(s, auth, nil).ServeHTTP(rec, newRequest("GET", path))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+	assert.Empty(t, s.denied)
+}
+
+func TestAuditRequiresAdminRole(t *testing.T) {
+	auth, _ := NewAuthenticator([]string{"ops:adm1n:admin", "dashboard:r3ad:read"}, "")
+	s := &dummyService{initialised: true, dataLoaded: true}
+	for key, statusCode := range map[string]int{"": http.StatusUnauthorized, "r3ad": http.StatusForbidden, "adm1n": http.StatusOK} {
+		req := newRequest("GET", "/transformers/brands/__audit")
+		req.Header.Set("X-Api-Key", key)
+		rec := httptest.NewRecorder()
+		newRouter(s, auth, nil).ServeHTTP(rec, req)
+		assert.Equal(t, statusCode, rec.Code, key)
+	}
+	assert.Len(t, s.denied, 2)
+}
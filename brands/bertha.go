@@ -0,0 +1,101 @@
+package brands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// berthaFields - the berthaBrand fields, by JSON name, that can be read from a CSV export of the spreadsheet
+var berthaFields = []string{"active", "prefLabel", "strapline", "imageurl", "descriptionxml", "tmeidentifier", "tmeparentidentifier"}
+
+// parseBerthaBrands - read the curated brands from either a JSON array in the berthaBrand shape or a CSV export
+// of the spreadsheet. CSV columns are matched to fields through columns (field -> CSV header), defaulting to the
+// field's JSON name, ignoring case.
+func parseBerthaBrands(contents []byte, isCSV bool, columns map[string]string) ([]berthaBrand, error) {
+	var bBrands []berthaBrand
+	if !isCSV {
+		err := json.Unmarshal(contents, &bBrands)
+		return bBrands, err
+	}
+
+	r := csv.NewReader(bytes.NewReader(contents))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	index, err := berthaColumnIndex(header, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(field string) string {
+			if i, ok := index[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		active, _ := strconv.ParseBool(value("active"))
+		bBrands = append(bBrands, berthaBrand{
+			Active:              active,
+			PrefLabel:           value("prefLabel"),
+			Strapline:           value("strapline"),
+			ImageURL:            value("imageurl"),
+			DescriptionXML:      value("descriptionxml"),
+			TmeIdentifier:       value("tmeidentifier"),
+			TmeParentIdentifier: value("tmeparentidentifier"),
+		})
+	}
+	return bBrands, nil
+}
+
+func berthaColumnIndex(header []string, columns map[string]string) (map[string]int, error) {
+	for field := range columns {
+		if !isBerthaField(field) {
+			return nil, fmt.Errorf("Unknown Bertha field [%s] in CSV column mapping", field)
+		}
+	}
+
+	index := make(map[string]int)
+	for _, field := range berthaFields {
+		column := field
+		if c, ok := columns[field]; ok {
+			column = c
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), column) {
+				index[field] = i
+				break
+			}
+		}
+	}
+
+	for _, required := range []string{"prefLabel", "tmeidentifier"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("No column found in Bertha CSV for field [%s]", required)
+		}
+	}
+	return index, nil
+}
+
+func isBerthaField(field string) bool {
+	for _, f := range berthaFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package brands
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBerthaBrandsFromCSV(t *testing.T) {
+	contents := []byte("Active,Brand name,Strapline,imageurl,descriptionxml,TME ID,tmeparentidentifier,Notes\n" +
+		"TRUE,Financial Times,Make the right connections,http://aboutus.ft.com/files/2010/11/ft-logo.gif,\"<p>The FT, in brief</p>\",1234567890,TmeParentIdentifier,ignored\n" +
+		"false,Funky Chicken,,,,,,\n")
+
+	bBrands, err := parseBerthaBrands(contents, true, map[string]string{"prefLabel": "Brand name", "tmeidentifier": "TME ID"})
+	assert.NoError(t, err)
+	assert.Equal(t, []berthaBrand{
+		{
+			Active:              true,
+			PrefLabel:           "Financial Times",
+			Strapline:           "Make the right connections",
+			ImageURL:            "http://aboutus.ft.com/files/2010/11/ft-logo.gif",
+			DescriptionXML:      "<p>The FT, in brief</p>",
+			TmeIdentifier:       "1234567890",
+			TmeParentIdentifier: "TmeParentIdentifier",
+		},
+		{PrefLabel: "Funky Chicken"},
+	}, bBrands)
+}
+
+func TestParseBerthaBrandsFromCSVWithoutRequiredColumn(t *testing.T) {
+	_, err := parseBerthaBrands([]byte("prefLabel,strapline\nFT,Strapline\n"), true, nil)
+	assert.Error(t, err)
+}
+
+func TestParseBerthaBrandsWithUnknownColumnMapping(t *testing.T) {
+	_, err := parseBerthaBrands([]byte("prefLabel,tmeidentifier\nFT,1234567890\n"), true, map[string]string{"colour": "Colour"})
+	assert.Error(t, err)
+}
+
+func TestGetBerthaBrandsFromJSONFile(t *testing.T) {
+	tmpfile := writeTempSource(t, ".json", `[{"active":true,"prefLabel":"Financial Times","tmeidentifier":"1234567890"}]`)
+	defer os.Remove(tmpfile)
+
+	s := &brandServiceImpl{httpClient: &mockClient{}}
+	bBrands, err := s.getBerthaBrands(context.Background(), tmpfile)
+	assert.NoError(t, err)
+	assert.Equal(t, []berthaBrand{{Active: true, PrefLabel: "Financial Times", TmeIdentifier: "1234567890"}}, bBrands)
+}
+
+func TestBerthaLoadedFromCSVFile(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	berthaFile := writeTempSource(t, ".csv", "prefLabel,tmeidentifier,strapline,descriptionxml,imageurl,tmeparentidentifier\n"+
+		"Financial Times,1234567890,Make the right connections,<p>The Financial Times (FT) is one of the world’s leading business news and information organisations.</p>,http://aboutus.ft.com/files/2010/11/ft-logo.gif,TmeParentIdentifier\n")
+	defer os.Remove(berthaFile)
+
+	brandService := createTestBrandService(&dummyRepo{}, tmpfile.Name(), func(c *ServiceConfig) { c.BerthaURL = berthaFile })
+	defer brandService.Shutdown()
+	waitTillInit(t, brandService)
+	waitTillDataLoaded(t, brandService)
+
+	actualBrand, found, err := brandService.getBrandByUUID(context.Background(), expectedBrand.UUID)
+	assert.True(t, found)
+	assert.NoError(t, err)
+	assert.EqualValues(t, expectedBrand, actualBrand)
+}
@@ -0,0 +1,113 @@
+package brands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	checkpointBucket = "checkpoint"
+	checkpointKey    = "tme"
+	liveReloadJob    = "tme"
+)
+
+// RetryPolicy - how often, and how long to back off between attempts, a failed TME page is retried
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// reloadCheckpoint - how far through the TME taxonomies a reload job has got. It is written in the same
+// transaction as the brands of the page it follows, so a failed job can resume from the page after it.
+type reloadCheckpoint struct {
+	Job      string `json:"job"`
+	Taxonomy string `json:"taxonomy"`
+	Offset   int    `json:"offset"`
+}
+
+type brandBatch struct {
+	brands     []brand
+	checkpoint reloadCheckpoint
+}
+
+func (s *brandServiceImpl) getCheckpoint(job string) (reloadCheckpoint, bool) {
+	var cp reloadCheckpoint
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(checkpointBucket))
+		if bucket == nil {
+			return fmt.Errorf("Bucket %v not found!", checkpointBucket)
+		}
+		value := bucket.Get([]byte(checkpointKey))
+		if value == nil {
+			return nil
+		}
+		if err := json.Unmarshal(value, &cp); err != nil {
+			return err
+		}
+		found = cp.Job == job
+		return nil
+	})
+	if err != nil {
+		log.Warnf("Cannot read reload checkpoint, starting from scratch: %v", err.Error())
+		return reloadCheckpoint{}, false
+	}
+	return cp, found
+}
+
+func putCheckpoint(tx *bolt.Tx, cp reloadCheckpoint) error {
+	bucket := tx.Bucket([]byte(checkpointBucket))
+	if bucket == nil {
+		return fmt.Errorf("Cache bucket [%v] not found!", checkpointBucket)
+	}
+	value, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(checkpointKey), value)
+}
+
+func (s *brandServiceImpl) clearCheckpoint() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(checkpointBucket))
+		if bucket == nil {
+			return fmt.Errorf("Cache bucket [%v] not found!", checkpointBucket)
+		}
+		return bucket.Delete([]byte(checkpointKey))
+	})
+}
+
+// getTmePage - fetch a page of terms, retrying with exponential backoff according to the page retry policy
+func (s *brandServiceImpl) getTmePage(ctx context.Context, taxonomy TmeTaxonomy, startRecord int) ([]interface{}, error) {
+	backoff := s.pageRetryPolicy.Backoff
+	for attempt := 0; ; attempt++ {
+		// the span covers fetching the page and unmarshalling its XML, which both happen in the repository
+		_, span := startSpan(ctx, "tme.page", attribute.String("taxonomy", taxonomy.Name), attribute.Int("start_record", startRecord), attribute.Int("attempt", attempt))
+		start := time.Now()
+		terms, err := taxonomy.Repository.GetTmeTermsFromIndex(startRecord)
+		tmePageDuration.WithLabelValues(taxonomy.Name).Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.Int("terms", len(terms)))
+		endSpan(span, err)
+		if err == nil {
+			tmeTermsPerPage.WithLabelValues(taxonomy.Name).Observe(float64(len(terms)))
+			return terms, nil
+		}
+		tmePageErrors.WithLabelValues(taxonomy.Name).Inc()
+		if attempt >= s.pageRetryPolicy.MaxRetries {
+			return terms, err
+		}
+		log.Warnf("Error fetching page %d of TME taxonomy %s, retrying in %v: %v", startRecord, taxonomy.Name, backoff, err.Error())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, s.reloadCancelled(ctx.Err())
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,218 @@
+package brands
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyRepo struct {
+	sync.Mutex
+	terms    []term
+	failAt   int
+	failures int
+	calls    []int
+}
+
+func (r *flakyRepo) GetTmeTermsFromIndex(startRecord int) ([]interface{}, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.calls = append(r.calls, startRecord)
+	if startRecord == r.failAt && r.failures > 0 {
+		r.failures--
+		return nil, errors.New("TME timeout")
+	}
+	if startRecord >= len(r.terms) {
+		return []interface{}{}, nil
+	}
+	return []interface{}{r.terms[startRecord]}, nil
+}
+
+// Never used
+func (r *flakyRepo) GetTmeTermById(uuid string) (interface{}, error) {
+	return nil, nil
+}
+
+func (r *flakyRepo) reset(failures int) {
+	r.Lock()
+	defer r.Unlock()
+	r.failures = failures
+	r.calls = nil
+}
+
+var flakyTerms = []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}, {CanonicalName: "Third", RawID: "third"}}
+
+func TestFailedPageIsRetried(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := flakyRepo{terms: flakyTerms, failAt: 1, failures: 2}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.PageRetryPolicy = RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond} })
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+	assertCount(t, service, 3)
+	assert.Equal(t, []int{0, 1, 1, 1, 2, 3}, repo.calls)
+}
+
+func TestFailedReloadResumesFromCheckpoint(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := flakyRepo{terms: flakyTerms, failAt: 1}
+	s := &brandServiceImpl{taxonomies: []TmeTaxonomy{{Name: "Brands", Repository: &repo}}, maxTmeRecords: 1, initialised: true, cacheFileName: tmpfile.Name(), berthaURL: "http://bertha/url", uuidOverrides: berthaUUIDmap(), httpClient: &mockClient{}}
+	defer s.Shutdown()
+
+	repo.reset(1)
+	assert.Error(t, s.reloadDB(context.Background(), reloadTrigger{}))
+	cp, found := s.getCheckpoint(liveReloadJob)
+	assert.True(t, found)
+	assert.Equal(t, reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 1}, cp)
+	_, found = s.getCheckpoint("replay:20161018T155800.000Z")
+	assert.False(t, found)
+
+	repo.reset(0)
+	assert.NoError(t, s.reloadDB(context.Background(), reloadTrigger{}))
+	assert.Equal(t, []int{1, 2, 3}, repo.calls)
+	assertCount(t, s, 3)
+	_, found = s.getCheckpoint(liveReloadJob)
+	assert.False(t, found)
+
+	repo.reset(0)
+	assert.NoError(t, s.reloadDB(context.Background(), reloadTrigger{}))
+	assert.Equal(t, []int{0, 1, 2, 3}, repo.calls)
+	assertCount(t, s, 3)
+}
+
+type gatedRepo struct {
+	flakyRepo
+	gateAt  int
+	reached chan struct{}
+	release chan struct{}
+}
+
+func (r *gatedRepo) GetTmeTermsFromIndex(startRecord int) ([]interface{}, error) {
+	if startRecord == r.gateAt {
+		close(r.reached)
+		<-r.release
+	}
+	return r.flakyRepo.GetTmeTermsFromIndex(startRecord)
+}
+
+func TestStoppedReloadKeepsCheckpoint(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := gatedRepo{flakyRepo: flakyRepo{terms: flakyTerms, failAt: -1}, gateAt: 1, reached: make(chan struct{}), release: make(chan struct{})}
+	s := &brandServiceImpl{taxonomies: []TmeTaxonomy{{Name: "Brands", Repository: &repo}}, maxTmeRecords: 1, initialised: true, cacheFileName: tmpfile.Name(), berthaURL: "http://bertha/url", uuidOverrides: berthaUUIDmap(), httpClient: &mockClient{}}
+
+	result := make(chan error)
+	go func() {
+		result <- s.reloadDB(context.Background(), reloadTrigger{})
+	}()
+	<-repo.reached
+	s.StopReloads()
+	assert.True(t, s.isStopping())
+	close(repo.release)
+
+	assert.Equal(t, errReloadStopped, <-result)
+	cp, found := s.getCheckpoint(liveReloadJob)
+	assert.True(t, found)
+	assert.Equal(t, reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 2}, cp)
+	assert.Equal(t, reloadFailed, s.getLastReload().Status)
+
+	assert.Equal(t, errServiceStopping, s.reloadDB(context.Background(), reloadTrigger{}))
+	assert.NoError(t, s.Shutdown())
+}
+
+func TestCancelledReloadKeepsCheckpoint(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := gatedRepo{flakyRepo: flakyRepo{terms: flakyTerms, failAt: -1}, gateAt: 1, reached: make(chan struct{}), release: make(chan struct{})}
+	s := &brandServiceImpl{taxonomies: []TmeTaxonomy{{Name: "Brands", Repository: &repo}}, maxTmeRecords: 1, initialised: true, cacheFileName: tmpfile.Name(), berthaURL: "http://bertha/url", uuidOverrides: berthaUUIDmap(), httpClient: &mockClient{}}
+	defer s.Shutdown()
+	assert.False(t, s.cancelReload())
+
+	result := make(chan error)
+	go func() {
+		result <- s.reloadDB(context.Background(), reloadTrigger{})
+	}()
+	<-repo.reached
+	assert.True(t, s.cancelReload())
+	close(repo.release)
+
+	assert.Equal(t, errReloadCancelled, <-result)
+	cp, found := s.getCheckpoint(liveReloadJob)
+	assert.True(t, found)
+	assert.Equal(t, reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 2}, cp)
+	assert.False(t, s.cancelReload())
+
+	repo.reset(0)
+	assert.NoError(t, s.reloadDB(context.Background(), reloadTrigger{}))
+	assert.Equal(t, []int{2, 3}, repo.calls)
+	assertCount(t, s, 3)
+}
+
+func TestRetriesGiveUpWhenCancelled(t *testing.T) {
+	repo := flakyRepo{terms: flakyTerms, failAt: 0, failures: 1}
+	s := &brandServiceImpl{pageRetryPolicy: RetryPolicy{MaxRetries: 1, Backoff: time.Hour}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.getTmePage(ctx, TmeTaxonomy{Name: "Brands", Repository: &repo}, 0)
+	assert.Equal(t, errReloadCancelled, err)
+}
+
+func TestFailedBatchWriteKeepsCheckpoint(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	s := &brandServiceImpl{initialised: true, cacheFileName: tmpfile.Name()}
+	defer s.Shutdown()
+	assert.NoError(t, s.openDB())
+	assert.NoError(t, s.resetCache())
+
+	var wg sync.WaitGroup
+	c := make(chan brandBatch)
+	done := make(chan struct{})
+	failed := make(chan error, 1)
+	go s.processBrands(context.Background(), c, &wg, done, failed)
+	wg.Add(3)
+	c <- brandBatch{brands: []brand{{UUID: testUUID}}, checkpoint: reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 1}}
+	c <- brandBatch{brands: []brand{{UUID: ""}}, checkpoint: reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 2}}
+	c <- brandBatch{brands: []brand{{UUID: testUUID2}}, checkpoint: reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 3}}
+	close(c)
+	wg.Wait()
+	<-done
+
+	assert.Error(t, <-failed)
+	cp, found := s.getCheckpoint(liveReloadJob)
+	assert.True(t, found)
+	assert.Equal(t, reloadCheckpoint{Job: liveReloadJob, Taxonomy: "Brands", Offset: 1}, cp)
+	assertCount(t, s, 1)
+}
+
+func TestOnlyOneReloadRunsAtATime(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := gatedRepo{flakyRepo: flakyRepo{terms: flakyTerms, failAt: -1}, gateAt: 1, reached: make(chan struct{}), release: make(chan struct{})}
+	s := &brandServiceImpl{taxonomies: []TmeTaxonomy{{Name: "Brands", Repository: &repo}}, maxTmeRecords: 1, initialised: true, cacheFileName: tmpfile.Name(), berthaURL: "http://bertha/url", uuidOverrides: berthaUUIDmap(), httpClient: &mockClient{}}
+	defer s.Shutdown()
+
+	result := make(chan error)
+	go func() {
+		result <- s.reloadDB(context.Background(), reloadTrigger{})
+	}()
+	<-repo.reached
+	assert.Equal(t, errReloadInProgress, s.reloadDB(context.Background(), reloadTrigger{}))
+	assert.Equal(t, errReloadInProgress, s.startReloadDB(reloadTrigger{}))
+	assert.Equal(t, errReloadInProgress, s.replayDB(context.Background(), "20161018T155800.000Z", reloadTrigger{}))
+	close(repo.release)
+
+	assert.NoError(t, <-result)
+	assert.False(t, s.isReloading())
+	repo.gateAt = -1
+	repo.reset(0)
+	assert.NoError(t, s.reloadDB(context.Background(), reloadTrigger{}))
+	assert.Equal(t, []int{0, 1, 2, 3}, repo.calls)
+}
@@ -0,0 +1,277 @@
+package brands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The content codings responses are compressed with, in order of preference
+const (
+	zstdEncoding = "zstd"
+	gzipEncoding = "gzip"
+)
+
+// identityEncoding - no content coding, the body as it is
+const identityEncoding = ""
+
+var supportedEncodings = []string{zstdEncoding, gzipEncoding}
+
+// negotiateEncoding - the supported content coding the Accept-Encoding header prefers, or none for identity
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qualities[coding] = q
+	}
+	best, bestQ := "", 0.0
+	for _, coding := range supportedEncodings {
+		q, found := qualities[coding]
+		if !found {
+			q, found = qualities["*"]
+		}
+		if found && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// resettableEncoder - a compressor that can be reset to write to another writer, so it can be reused
+type resettableEncoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func newEncoder(encoding string, w io.Writer) (resettableEncoder, error) {
+	switch encoding {
+	case zstdEncoding:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case gzipEncoding:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("Unsupported content coding %s", encoding)
+}
+
+// encoderPools - the encoders of finished responses of each content coding, kept to spare allocating a new one, and
+// for zstd its tables, for every response
+var encoderPools = make(map[string]*sync.Pool)
+
+func init() {
+	for _, encoding := range supportedEncodings {
+		encoding := encoding
+		encoderPools[encoding] = &sync.Pool{New: func() interface{} {
+			e, err := newEncoder(encoding, nil)
+			if err != nil {
+				return nil
+			}
+			return e
+		}}
+	}
+}
+
+// getEncoder - an encoder from the content coding's pool, writing to w
+func getEncoder(encoding string, w io.Writer) (resettableEncoder, error) {
+	pool, found := encoderPools[encoding]
+	if !found {
+		return nil, fmt.Errorf("Unsupported content coding %s", encoding)
+	}
+	e, ok := pool.Get().(resettableEncoder)
+	if !ok {
+		return nil, fmt.Errorf("Cannot create a %s encoder", encoding)
+	}
+	e.Reset(w)
+	return e, nil
+}
+
+// putEncoder - return a closed encoder to its pool, without holding on to the writer it wrote to
+func putEncoder(encoding string, e resettableEncoder) {
+	e.Reset(nil)
+	encoderPools[encoding].Put(e)
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	encoder  resettableEncoder
+	decided  bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decide(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide - compress the body unless it has none, or the handler already encoded it
+func (w *compressWriter) decide(status int) {
+	w.decided = true
+	if w.Header().Get("Content-Encoding") != "" || status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		return
+	}
+	encoder, err := getEncoder(w.encoding, w.ResponseWriter)
+	if err != nil {
+		log.Errorf("Cannot compress the response: %v", err.Error())
+		return
+	}
+	w.encoder = encoder
+	w.Header().Set("Content-Encoding", w.encoding)
+	w.Header().Del("Content-Length")
+}
+
+func (w *compressWriter) close() {
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			log.Warnf("Error finishing the compressed response: %v", err.Error())
+			return
+		}
+		putEncoder(w.encoding, w.encoder)
+	}
+}
+
+// CompressionMiddleware - compress responses with zstd or gzip, as the client's Accept-Encoding prefers.
+// Responses the handler has already encoded, such as the precomputed brands dump, are passed through.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+		if encoding == "" || req.Method == http.MethodHead {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		compressed := &compressWriter{ResponseWriter: writer, encoding: encoding}
+		defer compressed.close()
+		next.ServeHTTP(compressed, req)
+	})
+}
+
+// brandsDump - the full brands listing, as it is and compressed with each supported content coding, at the end of a reload
+type brandsDump struct {
+	etag     string
+	modified time.Time
+	encoded  map[string][]byte
+}
+
+// buildBrandsDump - copy the full brands listing from the cache, as it is and compressed with every supported content coding
+func (s *brandServiceImpl) buildBrandsDump(ctx context.Context) (*brandsDump, error) {
+	_, span := startSpan(ctx, "cache.dump")
+	defer span.End()
+	buffers := map[string]*bytes.Buffer{identityEncoding: {}}
+	var encoders []io.WriteCloser
+	writers := []io.Writer{buffers[identityEncoding]}
+	for _, encoding := range supportedEncodings {
+		buffers[encoding] = &bytes.Buffer{}
+		encoder, err := newEncoder(encoding, buffers[encoding])
+		if err != nil {
+			return nil, err
+		}
+		encoders = append(encoders, encoder)
+		writers = append(writers, encoder)
+	}
+	s.RLock()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return writeBrands(tx, io.MultiWriter(writers...), brandFilter{}, nil)
+	})
+	s.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, encoder := range encoders {
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	built := time.Now().UTC()
+	dump := &brandsDump{etag: strconv.FormatInt(built.UnixNano(), 36), modified: built.Truncate(time.Second), encoded: make(map[string][]byte)}
+	for encoding, buffer := range buffers {
+		dump.encoded[encoding] = buffer.Bytes()
+	}
+	return dump, nil
+}
+
+// updateBrandsDump - replace the dump with one of the brands the reload loaded
+func (s *brandServiceImpl) updateBrandsDump() {
+	dump, err := s.buildBrandsDump(context.Background())
+	if err != nil {
+		log.Errorf("Cannot build the brands dump, the full listing is streamed from the cache instead: %v", err.Error())
+		return
+	}
+	s.Lock()
+	s.dump = dump
+	s.Unlock()
+	log.Infof("Built the brands dump: %d bytes, %d bytes gzip, %d bytes zstd", len(dump.encoded[identityEncoding]), len(dump.encoded[gzipEncoding]), len(dump.encoded[zstdEncoding]))
+}
+
+// getBrandsDump - the full brands listing with the content coding, or none, with its ETag and time, if the last reload has built it
+func (s *brandServiceImpl) getBrandsDump(encoding string) (io.ReadSeeker, string, time.Time, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.dump == nil {
+		return nil, "", time.Time{}, false
+	}
+	encoded, found := s.dump.encoded[encoding]
+	if !found {
+		return nil, "", time.Time{}, false
+	}
+	etag := s.dump.etag
+	if encoding != identityEncoding {
+		etag += "-" + encoding
+	}
+	return bytes.NewReader(encoded), strconv.Quote(etag), s.dump.modified, true
+}
+
+// encodedWriter - marks a response of already encoded content with its content coding once its status is known.
+// http.ServeContent leaves out Content-Length for responses that already have a Content-Encoding.
+type encodedWriter struct {
+	http.ResponseWriter
+	encoding string
+}
+
+func (w encodedWriter) WriteHeader(status int) {
+	if w.encoding != identityEncoding && (status == http.StatusOK || status == http.StatusPartialContent) {
+		w.Header().Set("Content-Encoding", w.encoding)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// serveEncoded - serve content already encoded with the content coding, or none, with its length and support for range requests
+func serveEncoded(writer http.ResponseWriter, req *http.Request, encoding string, etag string, modified time.Time, content io.ReadSeeker) {
+	writer.Header().Set("ETag", etag)
+	http.ServeContent(encodedWriter{ResponseWriter: writer, encoding: encoding}, req, "", modified, content)
+}
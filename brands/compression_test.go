@@ -0,0 +1,159 @@
+package brands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for acceptEncoding, expected := range map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    gzipEncoding,
+		"gzip, deflate, br, zstd": zstdEncoding,
+		"zstd;q=0.5, gzip":        gzipEncoding,
+		"zstd;q=0, gzip;q=0":      "",
+		"*":                       zstdEncoding,
+		"*;q=0.1, GZIP;q=0.8":     gzipEncoding,
+		"deflate, br":             "",
+	} {
+		assert.Equal(t, expected, negotiateEncoding(acceptEncoding), acceptEncoding)
+	}
+}
+
+func TestResponsesAreCompressed(t *testing.T) {
+	service := &dummyService{initialised: true, dataLoaded: true, count: 2, brands: []brand{{UUID: testUUID}, {UUID: testUUID2}}}
+	decoders := map[string]func(body []byte) ([]byte, error){
+		gzipEncoding: func(body []byte) ([]byte, error) {
+			r, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.ReadAll(r)
+		},
+		zstdEncoding: func(body []byte) ([]byte, error) {
+			r, err := zstd.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return ioutil.ReadAll(r)
+		},
+	}
+	for encoding, decode := range decoders {
+		req := newRequest("GET", "/transformers/brands/__ids")
+		req.Header.Set("Accept-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		router(service).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, encoding)
+		assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+		body, err := decode(rec.Body.Bytes())
+		assert.NoError(t, err, encoding)
+		assert.Equal(t, getBrandUUIDsResponse, string(body), encoding)
+	}
+
+	rec := httptest.NewRecorder()
+	router(service).ServeHTTP(rec, newRequest("GET", "/transformers/brands/__ids"))
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, getBrandUUIDsResponse, rec.Body.String())
+}
+
+func TestEncodersAreReused(t *testing.T) {
+	service := &dummyService{initialised: true, dataLoaded: true, count: 2, brands: []brand{{UUID: testUUID}, {UUID: testUUID2}}}
+	for i := 0; i < 3; i++ {
+		req := newRequest("GET", "/transformers/brands/__ids")
+		req.Header.Set("Accept-Encoding", zstdEncoding)
+		rec := httptest.NewRecorder()
+		router(service).ServeHTTP(rec, req)
+		r, err := zstd.NewReader(bytes.NewReader(rec.Body.Bytes()))
+		if assert.NoError(t, err) {
+			body, err := ioutil.ReadAll(r)
+			r.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, getBrandUUIDsResponse, string(body), "A reused encoder starts a new frame for every response")
+		}
+	}
+
+	fresh := testing.AllocsPerRun(10, func() {
+		e, _ := newEncoder(zstdEncoding, ioutil.Discard)
+		e.Write([]byte(getBrandUUIDsResponse))
+		e.Close()
+	})
+	pooled := testing.AllocsPerRun(10, func() {
+		e, _ := getEncoder(zstdEncoding, ioutil.Discard)
+		e.Write([]byte(getBrandUUIDsResponse))
+		e.Close()
+		putEncoder(zstdEncoding, e)
+	})
+	assert.True(t, pooled < fresh, "A pooled encoder should spare allocating a new one, %v allocations against %v", pooled, fresh)
+}
+
+func TestBrandsDumpIsServed(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	rec := httptest.NewRecorder()
+	router(service).ServeHTTP(rec, newRequest("GET", "/transformers/brands"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"), "Clients without compression are served the dump too")
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+	listing := rec.Body.Bytes()
+
+	req := newRequest("GET", "/transformers/brands")
+	req.Header.Set("Range", "bytes=10-")
+	rec = httptest.NewRecorder()
+	router(service).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, listing[10:], rec.Body.Bytes())
+
+	req = newRequest("GET", "/transformers/brands")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	router(service).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, gzipEncoding, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	dump := rec.Body.Bytes()
+	r, err := gzip.NewReader(bytes.NewReader(dump))
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, string(listing), string(body))
+	}
+
+	req = newRequest("GET", "/transformers/brands")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=10-")
+	req.Header.Set("If-Range", etag)
+	rec = httptest.NewRecorder()
+	router(service).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, gzipEncoding, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, dump[10:], rec.Body.Bytes())
+
+	req = newRequest("GET", "/transformers/brands?fields=uuid")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	router(service).ServeHTTP(rec, req)
+	assert.Equal(t, gzipEncoding, rec.Header().Get("Content-Encoding"))
+	assert.Empty(t, rec.Header().Get("ETag"), "A projected listing is compressed as it is streamed, not served from the dump")
+}
@@ -0,0 +1,187 @@
+package brands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/tme-reader/tmereader"
+	log "github.com/Sirupsen/logrus"
+)
+
+// fileTmeRepository - a tmereader.Repository reading a taxonomy from TME XML dumps rather than from TME.
+// The dumps are the *.xml files in a directory named after the taxonomy, either on disk (where they may also be
+// gzipped, as in a PayloadArchive) or inside a tarball.
+type fileTmeRepository struct {
+	sync.Mutex
+	path         string
+	taxonomyName string
+	maxRecords   int
+	modeller     tmereader.Modeller
+	terms        []interface{}
+}
+
+// NewFileTmeRepository - create a tmereader.Repository for a taxonomy from a directory or (gzipped) tarball of TME XML dumps
+func NewFileTmeRepository(path string, taxonomyName string, maxRecords int, modeller tmereader.Modeller) tmereader.Repository {
+	return &fileTmeRepository{path: path, taxonomyName: taxonomyName, maxRecords: maxRecords, modeller: modeller}
+}
+
+// GetTmeTermsFromIndex - page through the terms in the dumps. The dumps are re-read whenever paging starts from 0.
+func (r *fileTmeRepository) GetTmeTermsFromIndex(startRecord int) ([]interface{}, error) {
+	r.Lock()
+	defer r.Unlock()
+	if startRecord == 0 || r.terms == nil {
+		terms, err := r.readTerms()
+		if err != nil {
+			return nil, err
+		}
+		r.terms = terms
+	}
+
+	if startRecord >= len(r.terms) {
+		return []interface{}{}, nil
+	}
+	end := startRecord + r.maxRecords
+	if end > len(r.terms) {
+		end = len(r.terms)
+	}
+	return r.terms[startRecord:end], nil
+}
+
+// GetTmeTermById - find a term in the dumps by its TME raw id
+func (r *fileTmeRepository) GetTmeTermById(rawID string) (interface{}, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.terms == nil {
+		terms, err := r.readTerms()
+		if err != nil {
+			return nil, err
+		}
+		r.terms = terms
+	}
+
+	for _, t := range r.terms {
+		if tmeTerm, ok := t.(term); ok && tmeTerm.RawID == rawID {
+			return tmeTerm, nil
+		}
+	}
+	return nil, fmt.Errorf("Term [%s] not found in taxonomy %s at [%s]", rawID, r.taxonomyName, r.path)
+}
+
+func (r *fileTmeRepository) readTerms() ([]interface{}, error) {
+	var contents [][]byte
+	var err error
+	if isTarball(r.path) {
+		contents, err = readTaxonomyFromTarball(r.path, r.taxonomyName)
+	} else {
+		contents, err = readTaxonomyFromDir(filepath.Join(r.path, r.taxonomyName))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []interface{}
+	for _, content := range contents {
+		t, err := r.modeller.UnMarshallTaxonomy(content)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t...)
+	}
+	log.Infof("Read %d terms of taxonomy %s from [%s]", len(terms), r.taxonomyName, r.path)
+	return terms, nil
+}
+
+func isTarball(path string) bool {
+	for _, suffix := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func readTaxonomyFromDir(dir string) ([][]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		return nil, err
+	}
+	gzipped, err := filepath.Glob(filepath.Join(dir, "*.xml.gz"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, gzipped...)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No TME XML files found in [%s]", dir)
+	}
+	sort.Strings(files)
+
+	var contents [][]byte
+	for _, file := range files {
+		content, err := readSource(context.Background(), file, nil)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+func readTaxonomyFromTarball(path string, taxonomyName string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if !strings.HasSuffix(path, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	files := make(map[string][]byte)
+	var names []string
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if !header.FileInfo().Mode().IsRegular() || filepath.Dir(name) != taxonomyName || filepath.Ext(name) != ".xml" {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No TME XML files found for taxonomy %s in [%s]", taxonomyName, path)
+	}
+	sort.Strings(names)
+
+	contents := make([][]byte, len(names))
+	for i, name := range names {
+		contents[i] = files[name]
+	}
+	return contents, nil
+}
@@ -0,0 +1,84 @@
+package brands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	firstDump  = `<taxonomy><term><name>Bob</name><id>bob</id></term><term><name>Fred</name><id>fred</id></term></taxonomy>`
+	secondDump = `<taxonomy><term><name>Third</name><id>third</id></term></taxonomy>`
+)
+
+func TestFileTmeRepositoryFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tme")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "Brands"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Brands", "0.xml"), []byte(firstDump), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Brands", "1.xml"), []byte(secondDump), 0600))
+
+	repo := NewFileTmeRepository(dir, "Brands", 2, new(BrandTransformer))
+	assertFileTmeRepositoryTerms(t, repo)
+}
+
+func TestFileTmeRepositoryFromTarball(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "tme")
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	tarball := tmpfile.Name() + ".tar.gz"
+	defer os.Remove(tarball)
+
+	f, err := os.Create(tarball)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{"./Brands/0.xml": firstDump, "./Brands/1.xml": secondDump, "./Sections/0.xml": secondDump} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, f.Close())
+
+	repo := NewFileTmeRepository(tarball, "Brands", 2, new(BrandTransformer))
+	assertFileTmeRepositoryTerms(t, repo)
+}
+
+func TestFileTmeRepositoryWithNoDumps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tme")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo := NewFileTmeRepository(dir, "Brands", 2, new(BrandTransformer))
+	_, err = repo.GetTmeTermsFromIndex(0)
+	assert.Error(t, err)
+}
+
+func assertFileTmeRepositoryTerms(t *testing.T, repo interface {
+	GetTmeTermsFromIndex(int) ([]interface{}, error)
+	GetTmeTermById(string) (interface{}, error)
+}) {
+	terms, err := repo.GetTmeTermsFromIndex(0)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{term{CanonicalName: "Bob", RawID: "bob"}, term{CanonicalName: "Fred", RawID: "fred"}}, terms)
+
+	terms, err = repo.GetTmeTermsFromIndex(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{term{CanonicalName: "Third", RawID: "third"}}, terms)
+
+	terms, err = repo.GetTmeTermsFromIndex(4)
+	assert.NoError(t, err)
+	assert.Empty(t, terms)
+
+	fred, err := repo.GetTmeTermById("fred")
+	assert.NoError(t, err)
+	assert.Equal(t, term{CanonicalName: "Fred", RawID: "fred"}, fred)
+}
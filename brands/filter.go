@@ -0,0 +1,99 @@
+package brands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// brandFilter - the brands a listing is limited to. The zero brandFilter matches every brand.
+type brandFilter struct {
+	Parent         string
+	Curated        *bool
+	HasImage       *bool
+	HasDescription *bool
+	Taxonomy       string
+	ModifiedSince  time.Time
+}
+
+// parseBrandFilter - parse the parent, curated, hasImage, hasDescription, taxonomy and modifiedSince query parameters
+func parseBrandFilter(query url.Values) (brandFilter, error) {
+	var f brandFilter
+	var err error
+	f.Parent = query.Get("parent")
+	f.Taxonomy = query.Get("taxonomy")
+	if f.Curated, err = parseBoolFilter(query, "curated"); err != nil {
+		return f, err
+	}
+	if f.HasImage, err = parseBoolFilter(query, "hasImage"); err != nil {
+		return f, err
+	}
+	if f.HasDescription, err = parseBoolFilter(query, "hasDescription"); err != nil {
+		return f, err
+	}
+	if param := query.Get("modifiedSince"); param != "" {
+		if f.ModifiedSince, err = time.Parse(time.RFC3339, param); err != nil {
+			if f.ModifiedSince, err = time.Parse("2006-01-02", param); err != nil {
+				return f, fmt.Errorf("Invalid modifiedSince %s, expected an RFC3339 time or a date", param)
+			}
+		}
+	}
+	return f, nil
+}
+
+func parseBoolFilter(query url.Values, name string) (*bool, error) {
+	param := query.Get(name)
+	if param == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %s, expected true or false", name, param)
+	}
+	return &value, nil
+}
+
+func (f brandFilter) isEmpty() bool {
+	return f.Parent == "" && f.Curated == nil && f.HasImage == nil && f.HasDescription == nil && f.Taxonomy == "" && f.ModifiedSince.IsZero()
+}
+
+// matches - whether the brand passes every part of the filter. Brands without a last modified date never match modifiedSince.
+func (f brandFilter) matches(b brand) bool {
+	if f.Parent != "" && !strings.EqualFold(b.ParentUUID, f.Parent) {
+		return false
+	}
+	if f.Curated != nil && *f.Curated == b.Uncurated {
+		return false
+	}
+	if f.HasImage != nil && *f.HasImage != (b.ImageURL != "") {
+		return false
+	}
+	if f.HasDescription != nil && *f.HasDescription != (b.Description != "" || b.DescriptionXML != "") {
+		return false
+	}
+	if f.Taxonomy != "" && !strings.EqualFold(b.Taxonomy, f.Taxonomy) {
+		return false
+	}
+	if !f.ModifiedSince.IsZero() {
+		modified, err := time.Parse(time.RFC3339, b.LastModifiedDate)
+		if err != nil || modified.Before(f.ModifiedSince) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCached - whether the brand, as written in the cache, passes the filter, skipping the unmarshalling when there's nothing to filter on
+func (f brandFilter) matchesCached(cached []byte) (bool, error) {
+	if f.isEmpty() {
+		return true, nil
+	}
+	var b brand
+	if err := json.Unmarshal(cached, &b); err != nil {
+		return false, err
+	}
+	return f.matches(b), nil
+}
@@ -0,0 +1,78 @@
+package brands
+
+import (
+	"bufio"
+	"context"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBrandFilter(t *testing.T) {
+	filter, err := parseBrandFilter(url.Values{"parent": {financialTimesBrandUuid}, "curated": {"false"}, "modifiedSince": {"2016-10-18"}})
+	assert.NoError(t, err)
+	assert.Equal(t, financialTimesBrandUuid, filter.Parent)
+	if assert.NotNil(t, filter.Curated) {
+		assert.False(t, *filter.Curated)
+	}
+	assert.Nil(t, filter.HasImage)
+	assert.Equal(t, time.Date(2016, 10, 18, 0, 0, 0, 0, time.UTC), filter.ModifiedSince)
+
+	filter, err = parseBrandFilter(url.Values{})
+	assert.NoError(t, err)
+	assert.True(t, filter.isEmpty())
+
+	_, err = parseBrandFilter(url.Values{"hasImage": {"yes"}})
+	assert.EqualError(t, err, "Invalid hasImage yes, expected true or false")
+	_, err = parseBrandFilter(url.Values{"modifiedSince": {"yesterday"}})
+	assert.Error(t, err)
+}
+
+func TestBrandFilterMatches(t *testing.T) {
+	yes, no := true, false
+	b := brand{UUID: bobUuid, ParentUUID: financialTimesBrandUuid, Taxonomy: "Brands", ImageURL: "http://bob.com/bob.png", LastModifiedDate: "2016-10-18T15:58:00Z", Uncurated: true}
+	tests := []struct {
+		name    string
+		filter  brandFilter
+		matches bool
+	}{
+		{"No filter", brandFilter{}, true},
+		{"Parent", brandFilter{Parent: financialTimesBrandUuid}, true},
+		{"Other parent", brandFilter{Parent: testUUID}, false},
+		{"Curated", brandFilter{Curated: &yes}, false},
+		{"Uncurated", brandFilter{Curated: &no}, true},
+		{"Has image", brandFilter{HasImage: &yes}, true},
+		{"Has description", brandFilter{HasDescription: &yes}, false},
+		{"Taxonomy, ignoring case", brandFilter{Taxonomy: "brands"}, true},
+		{"Modified since before", brandFilter{ModifiedSince: time.Date(2016, 10, 18, 0, 0, 0, 0, time.UTC)}, true},
+		{"Modified since after", brandFilter{ModifiedSince: time.Date(2016, 10, 19, 0, 0, 0, 0, time.UTC)}, false},
+		{"Every part", brandFilter{Parent: financialTimesBrandUuid, Curated: &no, HasImage: &no}, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.matches, test.filter.matches(b), test.name)
+	}
+	assert.False(t, brandFilter{ModifiedSince: time.Now()}.matches(brand{UUID: bobUuid}), "A brand without a last modified date")
+}
+
+func TestFilteredBrandUUIDsAreStreamed(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	curated := berthaBrand{PrefLabel: "Bob", TmeIdentifier: buildTmeIdentifier("bob", "Brands")}
+	service := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&mockClient{resp: []berthaBrand{curated}}))
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	yes := true
+	pv, err := service.getBrandUUIDs(context.Background(), brandFilter{Curated: &yes})
+	if !assert.NoError(t, err) {
+		return
+	}
+	scanner := bufio.NewScanner(pv)
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, `{"ID":"`+bobUuid+`"}`, scanner.Text())
+	assert.False(t, scanner.Scan())
+}
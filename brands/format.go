@@ -0,0 +1,131 @@
+package brands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The formats of the listings, one JSON object per line or a JSON array
+const (
+	ndjsonFormat    = "ndjson"
+	jsonArrayFormat = "json-array"
+
+	ndjsonContentType = "application/x-ndjson"
+	jsonContentType   = "application/json"
+
+	// streamErrorTrailer - the trailer set when a listing fails after it has started, so a truncated listing can be told apart from a complete one
+	streamErrorTrailer = "X-Stream-Error"
+)
+
+// listingFormat - the listing format given by ?format=, or else the Accept header. NDJSON, as listings always were,
+// whenever the Accept header allows it, so a missing header or */* keep getting it. A JSON array when ?format=json-array
+// asks for one, or when application/json is acceptable and application/x-ndjson is not.
+func listingFormat(req *http.Request) (string, error) {
+	switch format := req.URL.Query().Get("format"); format {
+	case ndjsonFormat, jsonArrayFormat:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("Unknown format %s, expected %s or %s", format, ndjsonFormat, jsonArrayFormat)
+	}
+	accept := req.Header.Get("Accept")
+	if accept == "" || acceptQuality(accept, ndjsonContentType) > 0 {
+		return ndjsonFormat, nil
+	}
+	if acceptQuality(accept, jsonContentType) > 0 {
+		return jsonArrayFormat, nil
+	}
+	return ndjsonFormat, nil
+}
+
+// acceptQuality - the quality the Accept header gives the media type, by the most specific range matching it, zero if none does
+func acceptQuality(accept string, mediaType string) float64 {
+	quality, specificity := 0.0, 0
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		matched := 0
+		switch {
+		case mediaRange == mediaType:
+			matched = 3
+		case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+			matched = 2
+		case mediaRange == "*/*":
+			matched = 1
+		}
+		if matched <= specificity {
+			continue
+		}
+		quality, specificity = 1.0, matched
+		if q, found := params["q"]; found {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+	}
+	return quality
+}
+
+func formatContentType(format string) string {
+	if format == jsonArrayFormat {
+		return jsonContentType
+	}
+	return ndjsonContentType
+}
+
+// writeListing - copy the NDJSON listing to the writer in the format.
+// A failure part way through sets the X-Stream-Error trailer, and leaves a JSON array unterminated.
+func writeListing(writer http.ResponseWriter, format string, listing io.Reader) {
+	writer.Header().Set("Trailer", streamErrorTrailer)
+	writer.WriteHeader(http.StatusOK)
+	var err error
+	if format == jsonArrayFormat {
+		err = writeJSONArray(writer, listing)
+	} else {
+		_, err = io.Copy(writer, listing)
+	}
+	if err == nil {
+		return
+	}
+	log.Errorf("Listing failed part way through: %v", err.Error())
+	writer.Header().Set(streamErrorTrailer, err.Error())
+}
+
+// writeJSONArray - write the lines of the NDJSON listing as the elements of a JSON array, closing it only if the listing completes
+func writeJSONArray(w io.Writer, listing io.Reader) error {
+	reader := bufio.NewReader(listing)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if !first {
+				io.WriteString(w, ",")
+			}
+			first = false
+			if _, err := w.Write(trimmed); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
@@ -0,0 +1,104 @@
+package brands
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingFormat(t *testing.T) {
+	tests := []struct {
+		url    string
+		accept string
+		format string
+	}{
+		{"/transformers/brands", "", ndjsonFormat},
+		{"/transformers/brands", "*/*", ndjsonFormat},
+		{"/transformers/brands", "application/x-ndjson", ndjsonFormat},
+		{"/transformers/brands", "application/json", jsonArrayFormat},
+		{"/transformers/brands", "text/html, application/json;q=0.9", jsonArrayFormat},
+		{"/transformers/brands", "application/json, */*;q=0.1", ndjsonFormat},
+		{"/transformers/brands", "application/json, application/x-ndjson;q=0.5", ndjsonFormat},
+		{"/transformers/brands", "application/*", ndjsonFormat},
+		{"/transformers/brands", "application/json, application/x-ndjson;q=0", jsonArrayFormat},
+		{"/transformers/brands", "text/html", ndjsonFormat},
+		{"/transformers/brands?format=ndjson", "application/json", ndjsonFormat},
+		{"/transformers/brands?format=json-array", "", jsonArrayFormat},
+		{"/transformers/brands?format=json-array", "application/x-ndjson", jsonArrayFormat},
+	}
+	for _, test := range tests {
+		req := newRequest("GET", test.url)
+		req.Header.Set("Accept", test.accept)
+		format, err := listingFormat(req)
+		assert.NoError(t, err, test.url)
+		assert.Equal(t, test.format, format, "%s with Accept %s", test.url, test.accept)
+	}
+
+	for _, url := range []string{"/transformers/brands?format=csv", "/transformers/brands?format=json"} {
+		_, err := listingFormat(newRequest("GET", url))
+		assert.Error(t, err, url)
+	}
+}
+
+func TestListingFormats(t *testing.T) {
+	service := &dummyService{initialised: true, dataLoaded: true, count: 2, brands: []brand{{UUID: testUUID}, {UUID: testUUID2}}}
+
+	rec := httptest.NewRecorder()
+	router(service).ServeHTTP(rec, newRequest("GET", "/transformers/brands/__ids?format=json-array"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var ids []brandUUID
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &ids))
+	assert.Equal(t, []brandUUID{{UUID: testUUID}, {UUID: testUUID2}}, ids)
+	assert.Empty(t, rec.Result().Trailer.Get(streamErrorTrailer), "A complete listing is not marked as failed")
+
+	req := newRequest("GET", "/transformers/brands/__ids")
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec = httptest.NewRecorder()
+	router(service).ServeHTTP(rec, req)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	assert.Equal(t, getBrandUUIDsResponse, rec.Body.String())
+	assert.Empty(t, rec.Result().Trailer.Get(streamErrorTrailer), "A complete listing is not marked as failed")
+
+	rec = httptest.NewRecorder()
+	router(service).ServeHTTP(rec, newRequest("GET", "/transformers/brands?format=xml"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router(&dummyService{initialised: true, dataLoaded: true, count: 1}).ServeHTTP(rec, newRequest("GET", "/transformers/brands?format=json-array&parent="+testUUID))
+	assert.Equal(t, "[]\n", rec.Body.String())
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("Cache read failed")
+}
+
+func TestListingFailureIsDetectable(t *testing.T) {
+	listing := func() io.Reader {
+		return io.MultiReader(strings.NewReader("{\"ID\":\"a\"}\n{\"ID\""), failingReader{})
+	}
+
+	rec := httptest.NewRecorder()
+	writeListing(rec, ndjsonFormat, listing())
+	assert.Equal(t, "{\"ID\":\"a\"}\n{\"ID\"", rec.Body.String(), "No line is added that could be taken for another listed object")
+	assert.Equal(t, "Cache read failed", rec.Result().Trailer.Get(streamErrorTrailer))
+
+	rec = httptest.NewRecorder()
+	writeListing(rec, jsonArrayFormat, listing())
+	assert.Equal(t, "[{\"ID\":\"a\"}", rec.Body.String())
+	assert.False(t, json.Valid(rec.Body.Bytes()), "A failed JSON array listing should not parse")
+	assert.Equal(t, "Cache read failed", rec.Result().Trailer.Get(streamErrorTrailer))
+
+	rec = httptest.NewRecorder()
+	writeListing(rec, jsonArrayFormat, strings.NewReader("{\"ID\":\"a\"}\n{\"ID\":\"b\"}\n"))
+	assert.Equal(t, "[{\"ID\":\"a\"},{\"ID\":\"b\"}]\n", rec.Body.String())
+	assert.Empty(t, rec.Result().Trailer.Get(streamErrorTrailer))
+}
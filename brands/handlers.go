@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Financial-Times/go-fthealth/v1a"
 	"github.com/Financial-Times/service-status-go/gtg"
@@ -24,70 +26,118 @@ func NewBrandHandler(service BrandService) BrandHandler {
 	return BrandHandler{service}
 }
 
-// GetBrands - Return a JSON encoded list of all brands
+// GetBrands - Return all brands matching the filter parameters as NDJSON or a JSON array, limited to the brand fields in ?fields= if given
 func (h *BrandHandler) GetBrands(writer http.ResponseWriter, req *http.Request) {
 	writer.Header().Add("Content-Type", "application/json")
 	if !h.service.isInitialised() || !h.service.isDataLoaded() {
-		writeStatusServiceUnavailable(writer)
+		writeStatusServiceUnavailable(writer, req)
 		return
 	}
 
-	if c, _ := h.service.getCount(); c == 0 {
-		writeJSONMessageWithStatus(writer, "Brands not found", http.StatusNotFound)
+	format, err := listingFormat(req)
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseBrandFilter(req.URL.Query())
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFieldProjection(req.URL.Query().Get("fields"))
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if c, _ := h.service.getCount(req.Context()); c == 0 {
+		writeProblem(writer, req, http.StatusNotFound, "Brands not found")
 		return
 	}
 
-	pv, err := h.service.getBrands()
+	if format == ndjsonFormat && filter.isEmpty() && fields == nil {
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+		if dump, etag, modified, found := h.service.getBrandsDump(encoding); found {
+			writer.Header().Set("Content-Type", ndjsonContentType)
+			serveEncoded(writer, req, encoding, etag, modified, dump)
+			return
+		}
+	}
+
+	pv, err := h.service.getBrands(req.Context(), filter, fields)
 
 	if err != nil {
-		writeJSONMessageWithStatus(writer, err.Error(), http.StatusInternalServerError)
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer pv.Close()
-	writer.WriteHeader(http.StatusOK)
-	io.Copy(writer, &pv)
+	writer.Header().Set("Content-Type", formatContentType(format))
+	writeListing(writer, format, pv)
 }
 
-// GetBrandUUIDs - Get a list of JSON objects (not a JSON list) giving each id.
+// GetBrandUUIDs - Get the id of each brand matching the filter parameters, as NDJSON or a JSON array.
 func (h *BrandHandler) GetBrandUUIDs(writer http.ResponseWriter, req *http.Request) {
 	writer.Header().Add("Content-Type", "application/json")
 	if !h.service.isInitialised() || !h.service.isDataLoaded() {
-		writeStatusServiceUnavailable(writer)
+		writeStatusServiceUnavailable(writer, req)
+		return
+	}
+
+	format, err := listingFormat(req)
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseBrandFilter(req.URL.Query())
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if c, _ := h.service.getCount(); c == 0 {
-		writeJSONMessageWithStatus(writer, "Brands not found", http.StatusNotFound)
+	if c, _ := h.service.getCount(req.Context()); c == 0 {
+		writeProblem(writer, req, http.StatusNotFound, "Brands not found")
 		return
 	}
 
-	pv, err := h.service.getBrandUUIDs()
+	pv, err := h.service.getBrandUUIDs(req.Context(), filter)
 
 	if err != nil {
-		writeJSONMessageWithStatus(writer, err.Error(), http.StatusInternalServerError)
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer pv.Close()
-	writer.WriteHeader(http.StatusOK)
-	io.Copy(writer, &pv)
+	writer.Header().Set("Content-Type", formatContentType(format))
+	writeListing(writer, format, pv)
 }
 
 // GetCount - Get a count of the number of available brands
 func (h *BrandHandler) GetCount(writer http.ResponseWriter, req *http.Request) {
 	if !h.service.isInitialised() || !h.service.isDataLoaded() {
 		writer.Header().Add("Content-Type", "application/json")
-		writeStatusServiceUnavailable(writer)
+		writeStatusServiceUnavailable(writer, req)
 		return
 	}
-	count, err := h.service.getCount()
+	count, err := h.service.getCount(req.Context())
 	if err != nil {
 		writer.Header().Add("Content-Type", "application/json")
-		writeJSONMessageWithStatus(writer, err.Error(), http.StatusInternalServerError)
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 	writer.Write([]byte(strconv.Itoa(count)))
 }
 
+// GetUUIDOverrides - Return the TME identifier to UUID override table as a JSON object
+func (h *BrandHandler) GetUUIDOverrides(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/json")
+	if !h.service.isInitialised() {
+		writeStatusServiceUnavailable(writer, req)
+		return
+	}
+	writeJSONResponse(writer, req, h.service.getUUIDOverrides())
+}
+
 // HealthCheck - Return FT standard healthcheck
 func (h *BrandHandler) HealthCheck() v1a.Check {
 
@@ -106,8 +156,170 @@ func (h *BrandHandler) HealthCheck() v1a.Check {
 	}
 }
 
+// ReloadHealthCheck - Check the last reload served TME and curated brands, reporting the Bertha failure policy it ran with
+func (h *BrandHandler) ReloadHealthCheck() v1a.Check {
+
+	return v1a.Check{
+		BusinessImpact:   "Brands may be served without, or with out of date, curated information from Bertha",
+		Name:             "Check the last reload succeeded.",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer",
+		Severity:         2,
+		TechnicalSummary: "The last reload failed, or Bertha failed and the reload fell back according to the Bertha failure policy. Check the errors in GET /transformers/brands/__reload.",
+		Checker: func() (string, error) {
+			result := h.service.getLastReload()
+			if result.Status == reloadFailed || result.Status == reloadDegraded {
+				return "", fmt.Errorf("Last reload %s %s with Bertha failure policy %s: %s", result.Job, result.Status, result.BerthaFailurePolicy, strings.Join(result.Errors, "; "))
+			}
+			return fmt.Sprintf("Last reload %s %s with Bertha failure policy %s", result.Job, result.Status, result.BerthaFailurePolicy), nil
+		},
+	}
+}
+
+// TmeHealthCheck - Check TME can be reached and accepts our credentials for the probe's taxonomy
+func (h *BrandHandler) TmeHealthCheck(probe *UpstreamProbe) v1a.Check {
+	return h.upstreamHealthCheck(probe, v1a.Check{
+		BusinessImpact:   "Brands cannot be reloaded from TME, the last loaded brands are still served",
+		Name:             "Check connectivity to TME taxonomy " + probe.taxonomy,
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer",
+		Severity:         2,
+		TechnicalSummary: "TME is unreachable or rejected the configured username, password or token. Check TME is up before investigating this service.",
+	})
+}
+
+// BerthaHealthCheck - Check the Bertha URL, or local file, of curated brands can be read
+func (h *BrandHandler) BerthaHealthCheck(probe *UpstreamProbe) v1a.Check {
+	return h.upstreamHealthCheck(probe, v1a.Check{
+		BusinessImpact:   "Curated brand information cannot be reloaded from Bertha",
+		Name:             "Check connectivity to Bertha",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer",
+		Severity:         2,
+		TechnicalSummary: "The Bertha URL of curated brands is unreachable. Check Bertha and the spreadsheet behind it before investigating this service.",
+	})
+}
+
+func (h *BrandHandler) upstreamHealthCheck(probe *UpstreamProbe, check v1a.Check) v1a.Check {
+	check.Checker = func() (string, error) {
+		lastFetch := "never"
+		if fetched, found := h.service.getLastFetch(probe.dependency); found {
+			lastFetch = fetched.Format(time.RFC3339)
+		}
+		latency, err := probe.probe()
+		if err != nil {
+			return "", fmt.Errorf("%s probe failed after %v: %v. Last successful fetch: %s", probe.dependency, latency, err, lastFetch)
+		}
+		return fmt.Sprintf("%s responded in %v. Last successful fetch: %s", probe.dependency, latency, lastFetch), nil
+	}
+	return check
+}
+
+// DataFreshnessHealthCheck - Check brands were loaded within the reload SLA
+func (h *BrandHandler) DataFreshnessHealthCheck(thresholds DataQualityThresholds) v1a.Check {
+	return v1a.Check{
+		BusinessImpact:   "Brands served may be out of date with TME and Bertha",
+		Name:             "Check brands were reloaded recently",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer#stale-brands",
+		Severity:         2,
+		TechnicalSummary: "No reload has served brands within the reload SLA. Check the last reload with GET /transformers/brands/__reload and the TME and Bertha checks, then POST /transformers/brands/__reload.",
+		Checker: func() (string, error) {
+			quality := h.service.getDataQuality()
+			if quality.LastLoaded.IsZero() {
+				return "", errors.New("No reload has served brands yet")
+			}
+			age := time.Since(quality.LastLoaded)
+			if age > thresholds.ReloadSLA {
+				return "", fmt.Errorf("Brands were last loaded %v ago, at %s, beyond the SLA of %v", age, quality.LastLoaded.Format(time.RFC3339), thresholds.ReloadSLA)
+			}
+			return fmt.Sprintf("Brands were last loaded %v ago, at %s", age, quality.LastLoaded.Format(time.RFC3339)), nil
+		},
+	}
+}
+
+// BrandCountHealthCheck - Check the number of brands hasn't dropped too far from the previous reload
+func (h *BrandHandler) BrandCountHealthCheck(thresholds DataQualityThresholds) v1a.Check {
+	return v1a.Check{
+		BusinessImpact:   "Brands may be missing, and deleted downstream by consumers of the full list",
+		Name:             "Check the number of brands has not dropped",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer#brand-count-dropped",
+		Severity:         1,
+		TechnicalSummary: "The last reload loaded far fewer brands than the one before it, usually a partial TME response. Hold off any concept publishing of the full list and reload.",
+		Checker: func() (string, error) {
+			quality := h.service.getDataQuality()
+			if quality.PreviousCount == 0 {
+				return fmt.Sprintf("%d brands loaded, no previous reload to compare with", quality.Count), nil
+			}
+			drop := 100 * float64(quality.PreviousCount-quality.Count) / float64(quality.PreviousCount)
+			if drop > thresholds.MaxCountDropPercent {
+				return "", fmt.Errorf("%d brands loaded, down %.1f%% from %d", quality.Count, drop, quality.PreviousCount)
+			}
+			return fmt.Sprintf("%d brands loaded, previously %d", quality.Count, quality.PreviousCount), nil
+		},
+	}
+}
+
+// UncuratedBrandsHealthCheck - Check how many brands have no curated information from Bertha
+func (h *BrandHandler) UncuratedBrandsHealthCheck(thresholds DataQualityThresholds) v1a.Check {
+	return v1a.Check{
+		BusinessImpact:   "Brands are served without their curated labels, straplines, descriptions and images",
+		Name:             "Check the number of uncurated brands",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer#uncurated-brands",
+		Severity:         3,
+		TechnicalSummary: "More brands than expected have no curated information, either Bertha failed during the reload or its rows don't match the TME brands.",
+		Checker: func() (string, error) {
+			quality := h.service.getDataQuality()
+			var percent float64
+			if quality.Count > 0 {
+				percent = 100 * float64(quality.Uncurated) / float64(quality.Count)
+			}
+			msg := fmt.Sprintf("%d of %d brands (%.1f%%) are uncurated", quality.Uncurated, quality.Count, percent)
+			if percent > thresholds.MaxUncuratedPercent {
+				return "", errors.New(msg)
+			}
+			return msg, nil
+		},
+	}
+}
+
+// OrphanParentsHealthCheck - Check every parent brand is itself a brand
+func (h *BrandHandler) OrphanParentsHealthCheck() v1a.Check {
+	return v1a.Check{
+		BusinessImpact:   "Brand hierarchies are broken for the brands under missing parents",
+		Name:             "Check every parent brand exists",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer#orphan-parents",
+		Severity:         3,
+		TechnicalSummary: "Some brands have a parent UUID that isn't a loaded brand. Check the parent in TME and the tmeparentidentifier column in Bertha.",
+		Checker: func() (string, error) {
+			quality := h.service.getDataQuality()
+			if len(quality.OrphanParents) > 0 {
+				return "", fmt.Errorf("%d parent brands are missing: %s", len(quality.OrphanParents), strings.Join(quality.OrphanParents, ", "))
+			}
+			return "Every parent brand exists", nil
+		},
+	}
+}
+
+// SkippedBerthaRowsHealthCheck - Check no curated brands were ignored for a missing TME identifier
+func (h *BrandHandler) SkippedBerthaRowsHealthCheck() v1a.Check {
+	return v1a.Check{
+		BusinessImpact:   "Curated brands are missing until editorial fill in their TME identifier",
+		Name:             "Check no curated brands were skipped",
+		PanicGuide:       "https://sites.google.com/a/ft.com/ft-technology-service-transition/home/run-book-library/v1-brands-transformer#skipped-bertha-rows",
+		Severity:         3,
+		TechnicalSummary: "Some rows of the Bertha spreadsheet have no tmeidentifier and were ignored. Ask editorial to fill them in; their labels are in the logs.",
+		Checker: func() (string, error) {
+			quality := h.service.getDataQuality()
+			if quality.SkippedBerthaRows > 0 {
+				return "", fmt.Errorf("%d curated brands were skipped for a missing TME identifier", quality.SkippedBerthaRows)
+			}
+			return "No curated brands were skipped", nil
+		},
+	}
+}
+
 // G2GCheck - Return FT standard good-to-go check
 func (h *BrandHandler) G2GCheck() gtg.Status {
+	if h.service.isStopping() {
+		return gtg.Status{GoodToGo: false, Message: "Shutting down"}
+	}
 	if h.service.isInitialised() && h.service.isDataLoaded() {
 		return gtg.Status{GoodToGo: true}
 	}
@@ -118,61 +330,212 @@ func (h *BrandHandler) G2GCheck() gtg.Status {
 func (h *BrandHandler) GetBrandByUUID(writer http.ResponseWriter, req *http.Request) {
 	writer.Header().Add("Content-Type", "application/json")
 	if !h.service.isInitialised() || !h.service.isDataLoaded() {
-		writeStatusServiceUnavailable(writer)
+		writeStatusServiceUnavailable(writer, req)
+		return
+	}
+
+	fields, err := parseFieldProjection(req.URL.Query().Get("fields"))
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	vars := mux.Vars(req)
 	uuid := vars["uuid"]
 
-	obj, found, err := h.service.getBrandByUUID(uuid)
+	obj, found, err := h.service.getBrandByUUID(req.Context(), uuid)
+	if err != nil {
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		canonicalUUID, isAlternative, err := h.service.getCanonicalUUID(req.Context(), uuid)
+		if err == nil && isAlternative {
+			writer.Header().Set("Location", strings.TrimSuffix(req.URL.Path, uuid)+canonicalUUID)
+			writer.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		writeProblem(writer, req, http.StatusNotFound, "Brand not found")
+		return
+	}
+	if fields != nil {
+		projected, err := projectBrand(obj, fields)
+		if err != nil {
+			writeProblem(writer, req, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSONResponse(writer, req, projected)
+		return
+	}
+	writeJSONResponse(writer, req, obj)
+}
+
+func projectBrand(b brand, fields fieldProjection) (json.RawMessage, error) {
+	marshalled, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return fields.project(marshalled)
+}
+
+// GetConcordances - Get the mapping of every identifier to its canonical brand UUID, as NDJSON or a JSON array
+func (h *BrandHandler) GetConcordances(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/json")
+	if !h.service.isInitialised() || !h.service.isDataLoaded() {
+		writeStatusServiceUnavailable(writer, req)
+		return
+	}
+
+	format, err := listingFormat(req)
+	if err != nil {
+		writeProblem(writer, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if c, _ := h.service.getCount(req.Context()); c == 0 {
+		writeProblem(writer, req, http.StatusNotFound, "Brands not found")
+		return
+	}
+
+	pv, err := h.service.getConcordances(req.Context())
+
 	if err != nil {
-		writeJSONMessageWithStatus(writer, err.Error(), http.StatusInternalServerError)
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
+		return
 	}
-	writeJSONResponse(obj, found, writer)
+	defer pv.Close()
+	writer.Header().Set("Content-Type", formatContentType(format))
+	writeListing(writer, format, pv)
 }
 
-// Reload - Reload the cache with fresh information
+// Reload - Reload the cache with fresh information, or from an archived reload given by the replay parameter
 func (h *BrandHandler) Reload(writer http.ResponseWriter, req *http.Request) {
-	go func() {
-		if err := h.service.reloadDB(); err != nil {
-			log.Errorf("ERROR reloading db: %v", err.Error())
+	trigger := newRequestTrigger(req)
+	if archiveID := req.URL.Query().Get("replay"); archiveID != "" {
+		if err := h.service.canReplay(archiveID); err == errArchiveResumed {
+			writeProblem(writer, req, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
+			writeProblem(writer, req, http.StatusNotFound, err.Error())
+			return
+		}
+		if err := h.service.startReplayDB(archiveID, trigger); err != nil {
+			writeReloadRefused(writer, req, err)
+			return
 		}
-	}()
+		writeJSONMessageWithStatus(writer, "Replaying brands from archive "+archiveID, http.StatusAccepted)
+		return
+	}
+
+	if err := h.service.startReloadDB(trigger); err != nil {
+		writeReloadRefused(writer, req, err)
+		return
+	}
 	writeJSONMessageWithStatus(writer, "Reloading brands", http.StatusAccepted)
 }
 
-func writeJSONResponse(obj interface{}, found bool, writer http.ResponseWriter) {
-	if !found {
-		writeJSONMessageWithStatus(writer, "Brand not found", http.StatusNotFound)
+// writeReloadRefused - the problem response for a reload or replay that couldn't start
+func writeReloadRefused(writer http.ResponseWriter, req *http.Request, err error) {
+	switch err {
+	case errReloadInProgress:
+		writeProblem(writer, req, http.StatusConflict, err.Error())
+	case errServiceStopping:
+		writeProblem(writer, req, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CancelReload - Cancel the running reload, which resumes from where it got to on the next reload
+func (h *BrandHandler) CancelReload(writer http.ResponseWriter, req *http.Request) {
+	if !h.service.cancelReload() {
+		writeProblem(writer, req, http.StatusConflict, "No reload in progress")
 		return
 	}
+	writeJSONMessageWithStatus(writer, "Cancelling reload", http.StatusAccepted)
+}
 
-	enc := json.NewEncoder(writer)
-	if err := enc.Encode(obj); err != nil {
+// GetLastReload - Return the result of the last, or the progress of the current, reload
+func (h *BrandHandler) GetLastReload(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/json")
+	writeJSONResponse(writer, req, h.service.getLastReload())
+}
+
+// GetAPIDocument - Return the OpenAPI document describing the endpoints
+func (h *BrandHandler) GetAPIDocument(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/json")
+	io.WriteString(writer, apiDocument)
+}
+
+// GetBrandSchema - Return the JSON Schema of the brands
+func (h *BrandHandler) GetBrandSchema(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/schema+json")
+	io.WriteString(writer, brandSchema)
+}
+
+// GetQuarantinedBrands - Return the brands the last reloads kept out of the cache for violating the brand schema
+func (h *BrandHandler) GetQuarantinedBrands(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/json")
+	quarantined, err := h.service.getQuarantinedBrands(req.Context())
+	if err != nil {
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSONResponse(writer, req, quarantined)
+}
+
+// GetAuditRecords - Return the audit records of the most recent reloads, newest first
+func (h *BrandHandler) GetAuditRecords(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Add("Content-Type", "application/json")
+	limit := defaultAuditLimit
+	if param := req.URL.Query().Get("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 {
+			writeProblem(writer, req, http.StatusBadRequest, "Invalid limit "+param)
+			return
+		}
+	}
+	records, err := h.service.getAuditRecords(req.Context(), limit)
+	if err != nil {
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSONResponse(writer, req, records)
+}
+
+// writeJSONResponse - write the object as JSON, or a problem if it can't be encoded.
+// Once the body has started there is no status left to change, so a failure to write it is only logged.
+func writeJSONResponse(writer http.ResponseWriter, req *http.Request, obj interface{}) {
+	body, err := json.Marshal(obj)
+	if err != nil {
 		log.Errorf("Error on json encoding=%v", err)
-		writeJSONMessageWithStatus(writer, err.Error(), http.StatusInternalServerError)
+		writeProblem(writer, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if _, err := writer.Write(append(body, '\n')); err != nil {
+		log.Errorf("Error writing the json response to %s: %v", req.URL.Path, err)
+	}
 }
 
+// writeJSONMessageWithStatus - write a {"message": ...} response, for the requests that succeed with only a message to return
 func writeJSONMessageWithStatus(w http.ResponseWriter, msg string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	fmt.Fprintln(w, fmt.Sprintf("{\"message\": \"%s\"}", msg))
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{msg})
 }
 
-func writeStatusServiceUnavailable(w http.ResponseWriter) {
-	writeJSONMessageWithStatus(w, "Service Unavailable", http.StatusServiceUnavailable)
+func writeStatusServiceUnavailable(w http.ResponseWriter, req *http.Request) {
+	writeProblem(w, req, http.StatusServiceUnavailable, "The brands are still loading")
 }
 
-//OnlyPostAllowed - Used to tell the user the METHOD type is not POST.
-func (h *BrandHandler) OnlyPostAllowed(writer http.ResponseWriter, req *http.Request) {
-	writer.Header().Set("Allow", "POST")
-	writer.WriteHeader(http.StatusMethodNotAllowed)
+//OnlyGetPostAndDeleteAllowed - Used to tell the user the METHOD type is not GET, POST or DELETE.
+func (h *BrandHandler) OnlyGetPostAndDeleteAllowed(writer http.ResponseWriter, req *http.Request) {
+	methodNotAllowed(writer, req, "GET", "POST", "DELETE")
 }
 
 //OnlyGetAllowed - Used to tell the user the METHOD type is not GET.
 func (h *BrandHandler) OnlyGetAllowed(writer http.ResponseWriter, req *http.Request) {
-	writer.Header().Set("Allow", "GET")
-	writer.WriteHeader(http.StatusMethodNotAllowed)
+	methodNotAllowed(writer, req, "GET")
 }
@@ -1,6 +1,8 @@
 package brands
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,9 +14,9 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/go-fthealth/v1a"
-	"github.com/Financial-Times/service-status-go/gtg"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -24,9 +26,15 @@ import (
 const (
 	testUUID              = "bba39990-c78d-3629-ae83-808c333c6dbc"
 	testUUID2             = "be2e7e2b-0fa2-3969-a69b-74c46e754032"
+	testTransactionID     = "tid_test"
+	testAPIKey            = "t3st-adm1n"
 	getBrandResponse      = "{\"uuid\":\"bba39990-c78d-3629-ae83-808c333c6dbc\",\"alternativeIdentifiers\":{}}\n{\"uuid\":\"be2e7e2b-0fa2-3969-a69b-74c46e754032\",\"alternativeIdentifiers\":{}}\n"
 	getBrandUUIDsResponse = `{"ID":"bba39990-c78d-3629-ae83-808c333c6dbc"}
 {"ID":"be2e7e2b-0fa2-3969-a69b-74c46e754032"}
+`
+	getConcordancesResponse = `{"identifier":"be2e7e2b-0fa2-3969-a69b-74c46e754032","authority":"UUID","canonicalUUID":"bba39990-c78d-3629-ae83-808c333c6dbc"}
+{"identifier":"bba39990-c78d-3629-ae83-808c333c6dbc","authority":"UUID","canonicalUUID":"bba39990-c78d-3629-ae83-808c333c6dbc"}
+{"identifier":"RlQK-QnJhbmRzCg==","authority":"TME","canonicalUUID":"bba39990-c78d-3629-ae83-808c333c6dbc"}
 `
 	getBrandByUUIDResponse = "{\"uuid\":\"bba39990-c78d-3629-ae83-808c333c6dbc\",\"prefLabel\":\"Financial Times\",\"type\":\"Brand\",\"alternativeIdentifiers\":{\"TME\":[\"RlQK-QnJhbmRzCg==\"],\"uuids\":[\"bba39990-c78d-3629-ae83-808c333c6dbc\"]}}\n"
 )
@@ -51,6 +59,26 @@ func TestHandlers(t *testing.T) {
 			http.StatusOK,
 			"application/json",
 			getBrandByUUIDResponse},
+		{"Success - get brand by uuid with fields",
+			newRequest("GET", fmt.Sprintf("/transformers/brands/%s?fields=prefLabel,uuid,parentUUID", testUUID)),
+			&dummyService{
+				found:       true,
+				initialised: true,
+				dataLoaded:  true,
+				brands:      []brand{{UUID: testUUID, PrefLabel: "Financial Times", AlternativeIdentifiers: alternativeIdentifiers{UUIDs: []string{testUUID}, TME: []string{"RlQK-QnJhbmRzCg=="}}, Type: "Brand"}}},
+			http.StatusOK,
+			"application/json",
+			"{\"uuid\":\"bba39990-c78d-3629-ae83-808c333c6dbc\",\"prefLabel\":\"Financial Times\"}\n"},
+		{"Bad request - get brand by uuid with unknown field",
+			newRequest("GET", fmt.Sprintf("/transformers/brands/%s?fields=uuid,name", testUUID)),
+			&dummyService{
+				found:       true,
+				initialised: true,
+				dataLoaded:  true,
+				brands:      []brand{{UUID: testUUID}}},
+			http.StatusBadRequest,
+			"application/problem+json",
+			problemResponse(http.StatusBadRequest, "/transformers/brands/"+testUUID, "Unknown field name, expected any of uuid,parentUUID,prefLabel,type,taxonomy,alternativeIdentifiers,aliases,strapline,description,descriptionXML,_imageUrl,broaderUUIDs,isDeprecated,createdDate,lastModifiedDate,uncurated")},
 		{"405 - get brand by uuid",
 			newRequest("POST", fmt.Sprintf("/transformers/brands/%s", testUUID)),
 			&dummyService{
@@ -59,8 +87,8 @@ func TestHandlers(t *testing.T) {
 				dataLoaded:  true,
 				brands:      []brand{{UUID: testUUID, PrefLabel: "Financial Times", AlternativeIdentifiers: alternativeIdentifiers{UUIDs: []string{testUUID}, TME: []string{"RlQK-QnJhbmRzCg=="}}, Type: "Brand"}}},
 			http.StatusMethodNotAllowed,
-			"application/json",
-			""},
+			"application/problem+json",
+			problemResponse(http.StatusMethodNotAllowed, "/transformers/brands/"+testUUID, "Method POST is not allowed, expected GET", "GET")},
 		{"Not found - get brand by uuid",
 			newRequest("GET", fmt.Sprintf("/transformers/brands/%s", testUUID)),
 			&dummyService{
@@ -69,8 +97,19 @@ func TestHandlers(t *testing.T) {
 				dataLoaded:  true,
 				brands:      []brand{{}}},
 			http.StatusNotFound,
+			"application/problem+json",
+			problemResponse(http.StatusNotFound, "/transformers/brands/"+testUUID, "Brand not found")},
+		{"Moved permanently - get brand by alternative uuid",
+			newRequest("GET", fmt.Sprintf("/transformers/brands/%s", testUUID2)),
+			&dummyService{
+				found:         false,
+				initialised:   true,
+				dataLoaded:    true,
+				canonicalUUID: testUUID,
+				brands:        []brand{{}}},
+			http.StatusMovedPermanently,
 			"application/json",
-			"{\"message\": \"Brand not found\"}\n"},
+			""},
 		{"Service unavailable - get brand by uuid",
 			newRequest("GET", fmt.Sprintf("/transformers/brands/%s", testUUID)),
 			&dummyService{
@@ -78,8 +117,8 @@ func TestHandlers(t *testing.T) {
 				initialised: false,
 				brands:      []brand{}},
 			http.StatusServiceUnavailable,
-			"application/json",
-			"{\"message\": \"Service Unavailable\"}\n"},
+			"application/problem+json",
+			problemResponse(http.StatusServiceUnavailable, "/transformers/brands/"+testUUID, "The brands are still loading")},
 		{"Success - get brands count",
 			newRequest("GET", "/transformers/brands/__count"),
 			&dummyService{
@@ -100,8 +139,8 @@ func TestHandlers(t *testing.T) {
 				dataLoaded:  true,
 				brands:      []brand{{UUID: testUUID}}},
 			http.StatusMethodNotAllowed,
-			"application/json",
-			""},
+			"application/problem+json",
+			problemResponse(http.StatusMethodNotAllowed, "/transformers/brands/__count", "Method POST is not allowed, expected GET", "GET")},
 		{"Failure - get brands count",
 			newRequest("GET", "/transformers/brands/__count"),
 			&dummyService{
@@ -112,8 +151,8 @@ func TestHandlers(t *testing.T) {
 				dataLoaded:  true,
 				brands:      []brand{{UUID: testUUID}}},
 			http.StatusInternalServerError,
-			"application/json",
-			"{\"message\": \"Something broke\"}\n"},
+			"application/problem+json",
+			problemResponse(http.StatusInternalServerError, "/transformers/brands/__count", "Something broke")},
 		{"Failure - get brands count not init",
 			newRequest("GET", "/transformers/brands/__count"),
 			&dummyService{
@@ -123,7 +162,8 @@ func TestHandlers(t *testing.T) {
 				initialised: false,
 				brands:      []brand{{UUID: testUUID}}},
 			http.StatusServiceUnavailable,
-			"application/json", "{\"message\": \"Service Unavailable\"}\n"},
+			"application/problem+json",
+			problemResponse(http.StatusServiceUnavailable, "/transformers/brands/__count", "The brands are still loading")},
 		{"get brands - success",
 			newRequest("GET", "/transformers/brands"),
 			&dummyService{
@@ -133,8 +173,48 @@ func TestHandlers(t *testing.T) {
 				count:       2,
 				brands:      []brand{{UUID: testUUID}, {UUID: testUUID2}}},
 			http.StatusOK,
-			"application/json",
+			"application/x-ndjson",
 			getBrandResponse},
+		{"get brands - fields",
+			newRequest("GET", "/transformers/brands?fields=uuid,prefLabel"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       2,
+				brands:      []brand{{UUID: testUUID, PrefLabel: "Financial Times", Description: "The FT"}, {UUID: testUUID2}}},
+			http.StatusOK,
+			"application/x-ndjson",
+			"{\"uuid\":\"bba39990-c78d-3629-ae83-808c333c6dbc\",\"prefLabel\":\"Financial Times\"}\n{\"uuid\":\"be2e7e2b-0fa2-3969-a69b-74c46e754032\"}\n"},
+		{"get brands - unknown field",
+			newRequest("GET", "/transformers/brands?fields=uuid,name"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       2,
+				brands:      []brand{{UUID: testUUID}, {UUID: testUUID2}}},
+			http.StatusBadRequest,
+			"application/problem+json",
+			problemResponse(http.StatusBadRequest, "/transformers/brands", "Unknown field name, expected any of uuid,parentUUID,prefLabel,type,taxonomy,alternativeIdentifiers,aliases,strapline,description,descriptionXML,_imageUrl,broaderUUIDs,isDeprecated,createdDate,lastModifiedDate,uncurated")},
+		{"get brands - filtered",
+			newRequest("GET", "/transformers/brands?parent="+testUUID+"&fields=uuid"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       2,
+				brands:      []brand{{UUID: testUUID}, {UUID: testUUID2, ParentUUID: testUUID}}},
+			http.StatusOK,
+			"application/x-ndjson",
+			"{\"uuid\":\"be2e7e2b-0fa2-3969-a69b-74c46e754032\"}\n"},
+		{"get brands - invalid filter",
+			newRequest("GET", "/transformers/brands?curated=maybe"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       2,
+				brands:      []brand{{UUID: testUUID}, {UUID: testUUID2}}},
+			http.StatusBadRequest,
+			"application/problem+json",
+			problemResponse(http.StatusBadRequest, "/transformers/brands", "Invalid curated maybe, expected true or false")},
 		{"get brands - 405",
 			newRequest("POST", "/transformers/brands"),
 			&dummyService{
@@ -144,8 +224,8 @@ func TestHandlers(t *testing.T) {
 				count:       2,
 				brands:      []brand{{UUID: testUUID}, {UUID: testUUID2}}},
 			http.StatusMethodNotAllowed,
-			"application/json",
-			""},
+			"application/problem+json",
+			problemResponse(http.StatusMethodNotAllowed, "/transformers/brands", "Method POST is not allowed, expected GET", "GET")},
 		{"get brands - Not found",
 			newRequest("GET", "/transformers/brands"),
 			&dummyService{
@@ -154,8 +234,8 @@ func TestHandlers(t *testing.T) {
 				count:       0,
 				brands:      []brand{}},
 			http.StatusNotFound,
-			"application/json",
-			"{\"message\": \"Brands not found\"}\n"},
+			"application/problem+json",
+			problemResponse(http.StatusNotFound, "/transformers/brands", "Brands not found")},
 		{"get brands - Service unavailable",
 			newRequest("GET", "/transformers/brands"),
 			&dummyService{
@@ -163,8 +243,8 @@ func TestHandlers(t *testing.T) {
 				initialised: false,
 				brands:      []brand{}},
 			http.StatusServiceUnavailable,
-			"application/json",
-			"{\"message\": \"Service Unavailable\"}\n"},
+			"application/problem+json",
+			problemResponse(http.StatusServiceUnavailable, "/transformers/brands", "The brands are still loading")},
 		{"get brands IDS - Success",
 			newRequest("GET", "/transformers/brands/__ids"),
 			&dummyService{
@@ -174,8 +254,18 @@ func TestHandlers(t *testing.T) {
 				count:       1,
 				brands:      []brand{{UUID: testUUID}, {UUID: testUUID2}}},
 			http.StatusOK,
-			"application/json",
+			"application/x-ndjson",
 			getBrandUUIDsResponse},
+		{"get brands IDS - Filtered",
+			newRequest("GET", "/transformers/brands/__ids?hasImage=true"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       2,
+				brands:      []brand{{UUID: testUUID, ImageURL: "http://ft.com/ft.png"}, {UUID: testUUID2}}},
+			http.StatusOK,
+			"application/x-ndjson",
+			"{\"ID\":\"bba39990-c78d-3629-ae83-808c333c6dbc\"}\n"},
 		{"get brands IDS - Not found",
 			newRequest("GET", "/transformers/brands/__ids"),
 			&dummyService{
@@ -184,8 +274,8 @@ func TestHandlers(t *testing.T) {
 				count:       0,
 				brands:      []brand{}},
 			http.StatusNotFound,
-			"application/json",
-			"{\"message\": \"Brands not found\"}\n"},
+			"application/problem+json",
+			problemResponse(http.StatusNotFound, "/transformers/brands/__ids", "Brands not found")},
 		{"get brands IDS - Service unavailable",
 			newRequest("GET", "/transformers/brands/__ids"),
 			&dummyService{
@@ -193,8 +283,49 @@ func TestHandlers(t *testing.T) {
 				initialised: false,
 				brands:      []brand{}},
 			http.StatusServiceUnavailable,
+			"application/problem+json",
+			problemResponse(http.StatusServiceUnavailable, "/transformers/brands/__ids", "The brands are still loading")},
+		{"Success - get concordances",
+			newRequest("GET", "/transformers/brands/__concordances"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       1,
+				brands:      []brand{{UUID: testUUID, AlternativeIdentifiers: alternativeIdentifiers{UUIDs: []string{testUUID2, testUUID}, TME: []string{"RlQK-QnJhbmRzCg=="}}}}},
+			http.StatusOK,
+			"application/x-ndjson",
+			getConcordancesResponse},
+		{"Not found - get concordances",
+			newRequest("GET", "/transformers/brands/__concordances"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				count:       0},
+			http.StatusNotFound,
+			"application/problem+json",
+			problemResponse(http.StatusNotFound, "/transformers/brands/__concordances", "Brands not found")},
+		{"Success - get UUID overrides",
+			newRequest("GET", "/transformers/brands/__uuid-overrides"),
+			&dummyService{
+				initialised:   true,
+				uuidOverrides: map[string]string{"QnJhbmRzXzg2-QnJhbmRz": "fd4459b2-cc4e-4ec8-9853-c5238eb860fb"}},
+			http.StatusOK,
 			"application/json",
-			"{\"message\": \"Service Unavailable\"}\n"},
+			"{\"QnJhbmRzXzg2-QnJhbmRz\":\"fd4459b2-cc4e-4ec8-9853-c5238eb860fb\"}\n"},
+		{"405 - get UUID overrides",
+			newRequest("POST", "/transformers/brands/__uuid-overrides"),
+			&dummyService{
+				initialised: true},
+			http.StatusMethodNotAllowed,
+			"application/problem+json",
+			problemResponse(http.StatusMethodNotAllowed, "/transformers/brands/__uuid-overrides", "Method POST is not allowed, expected GET", "GET")},
+		{"Service unavailable - get UUID overrides",
+			newRequest("GET", "/transformers/brands/__uuid-overrides"),
+			&dummyService{
+				initialised: false},
+			http.StatusServiceUnavailable,
+			"application/problem+json",
+			problemResponse(http.StatusServiceUnavailable, "/transformers/brands/__uuid-overrides", "The brands are still loading")},
 		{"GTG unavailable - get GTG",
 			newRequest("GET", status.GTGPath),
 			&dummyService{
@@ -243,6 +374,88 @@ func TestHandlers(t *testing.T) {
 			http.StatusOK,
 			"application/json",
 			"regex=Service is up and running"},
+		{"Health bad - reload degraded by Bertha failure",
+			newRequest("GET", "/__health"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				lastReload:  reloadResult{Job: "tme", Status: reloadDegraded, BerthaFailurePolicy: ServeTmeOnlyOnBerthaError, Errors: []string{"bertha fail"}}},
+			http.StatusOK,
+			"application/json",
+			"regex=Last reload tme degraded with Bertha failure policy tme-only: bertha fail"},
+		{"Get last reload",
+			newRequest("GET", "/transformers/brands/__reload"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true,
+				lastReload:  reloadResult{Job: "tme", Status: reloadSucceeded, BerthaFailurePolicy: FailOnBerthaError, Curated: true, Started: "2016-10-18T15:58:00Z", Finished: "2016-10-18T16:00:00Z"}},
+			http.StatusOK,
+			"application/json",
+			"{\"job\":\"tme\",\"status\":\"succeeded\",\"berthaFailurePolicy\":\"fail\",\"curated\":true,\"started\":\"2016-10-18T15:58:00Z\",\"finished\":\"2016-10-18T16:00:00Z\",\"counts\":{\"tmeBrands\":0,\"berthaRows\":0,\"curatedBrands\":0,\"curatedOnlyBrands\":0,\"skippedBerthaRows\":0,\"invalidBrands\":0,\"brands\":0,\"uncuratedBrands\":0}}\n"},
+		{"Get audit records",
+			newRequest("GET", "/transformers/brands/__audit?limit=1"),
+			&dummyService{
+				initialised:  true,
+				auditRecords: []json.RawMessage{json.RawMessage(`{"job":"tme"}`), json.RawMessage(`{"job":"replay:20161018T155800.000Z"}`)}},
+			http.StatusOK,
+			"application/json",
+			"[{\"job\":\"tme\"}]\n"},
+		{"Get audit records with invalid limit",
+			newRequest("GET", "/transformers/brands/__audit?limit=none"),
+			&dummyService{
+				initialised: true},
+			http.StatusBadRequest,
+			"application/problem+json",
+			problemResponse(http.StatusBadRequest, "/transformers/brands/__audit", "Invalid limit none")},
+		{"Cancel reload",
+			newRequest("DELETE", "/transformers/brands/__reload"),
+			&dummyService{
+				initialised: true,
+				reloading:   true},
+			http.StatusAccepted,
+			"application/json",
+			"{\"message\":\"Cancelling reload\"}\n"},
+		{"Cancel reload - none in progress",
+			newRequest("DELETE", "/transformers/brands/__reload"),
+			&dummyService{
+				initialised: true},
+			http.StatusConflict,
+			"application/problem+json",
+			problemResponse(http.StatusConflict, "/transformers/brands/__reload", "No reload in progress")},
+		{"405 - reload",
+			newRequest("PUT", "/transformers/brands/__reload"),
+			&dummyService{
+				initialised: true},
+			http.StatusMethodNotAllowed,
+			"application/problem+json",
+			problemResponse(http.StatusMethodNotAllowed, "/transformers/brands/__reload", "Method PUT is not allowed, expected GET, POST, DELETE", "GET", "POST", "DELETE")},
+		{"404 - unknown route",
+			newRequest("GET", "/transformers/brands/not-a-uuid"),
+			&dummyService{
+				initialised: true,
+				dataLoaded:  true},
+			http.StatusNotFound,
+			"application/problem+json",
+			problemResponse(http.StatusNotFound, "/transformers/brands/not-a-uuid", "No such endpoint /transformers/brands/not-a-uuid")},
+		{"409 - reload already in progress",
+			newRequest("POST", "/transformers/brands/__reload"),
+			&dummyService{
+				startErr:    errReloadInProgress,
+				initialised: true,
+				dataLoaded:  true},
+			http.StatusConflict,
+			"application/problem+json",
+			problemResponse(http.StatusConflict, "/transformers/brands/__reload", "A reload is already in progress")},
+		{"503 - reload while shutting down",
+			newRequest("POST", "/transformers/brands/__reload?replay=20161018T155800.000Z"),
+			&dummyService{
+				startErr:    errServiceStopping,
+				archiveID:   "20161018T155800.000Z",
+				initialised: true,
+				dataLoaded:  true},
+			http.StatusServiceUnavailable,
+			"application/problem+json",
+			problemResponse(http.StatusServiceUnavailable, "/transformers/brands/__reload", "Service is shutting down")},
 		{"Reload accepted - request reload",
 			newRequest("POST", "/transformers/brands/__reload"),
 			&dummyService{
@@ -251,7 +464,7 @@ func TestHandlers(t *testing.T) {
 				dataLoaded:  true},
 			http.StatusAccepted,
 			"application/json",
-			"{\"message\": \"Reloading brands\"}\n"},
+			"{\"message\":\"Reloading brands\"}\n"},
 		{"Reload accepted even though error loading data in background.",
 			newRequest("POST", "/transformers/brands/__reload"),
 			&dummyService{
@@ -261,7 +474,7 @@ func TestHandlers(t *testing.T) {
 				dataLoaded:  true},
 			http.StatusAccepted,
 			"application/json",
-			"{\"message\": \"Reloading brands\"}\n"},
+			"{\"message\":\"Reloading brands\"}\n"},
 	}
 	for _, test := range tests {
 		wg.Add(1)
@@ -295,9 +508,93 @@ func TestReloadIsCalled(t *testing.T) {
 		count:       2,
 		brands:      []brand{}}
 	log.Infof("s.loadDBCalled: %v", s.loadDBCalled)
-	router(s).ServeHTTP(rec, newRequest("POST", "/transformers/brands/__reload"))
+	req := newRequest("POST", "/transformers/brands/__reload")
+	req.Header.Set("X-Request-Id", "tid_reload")
+	req.RemoteAddr = "10.0.0.1:1234"
+	router(s).ServeHTTP(rec, req)
 	wg.Wait()
 	assert.True(t, s.loadDBCalled)
+	assert.Equal(t, reloadTrigger{Source: requestTrigger, Caller: "test (10.0.0.1)", TransactionID: "tid_reload"}, s.trigger)
+}
+
+func TestReplayIsCalled(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	rec := httptest.NewRecorder()
+	s := &dummyService{
+		wg:          &wg,
+		initialised: true,
+		dataLoaded:  true,
+		archiveID:   "20161018T155800.000Z"}
+	router(s).ServeHTTP(rec, newRequest("POST", "/transformers/brands/__reload?replay=20161018T155800.000Z"))
+	wg.Wait()
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "20161018T155800.000Z", s.replayedArchive)
+	assert.False(t, s.loadDBCalled)
+}
+
+func TestReplayUnknownArchive(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := &dummyService{
+		initialised: true,
+		dataLoaded:  true,
+		archiveID:   "20161018T155800.000Z"}
+	router(s).ServeHTTP(rec, newRequest("POST", "/transformers/brands/__reload?replay=20161018T160000.000Z"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, problemResponse(http.StatusNotFound, "/transformers/brands/__reload", "Archive [20161018T160000.000Z] not found"), rec.Body.String())
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.Empty(t, s.replayedArchive)
+}
+
+func TestReplayResumedArchive(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := &dummyService{
+		initialised: true,
+		dataLoaded:  true,
+		archiveID:   "20161018T155800.000Z",
+		replayErr:   errArchiveResumed}
+	router(s).ServeHTTP(rec, newRequest("POST", "/transformers/brands/__reload?replay=20161018T155800.000Z"))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, problemResponse(http.StatusUnprocessableEntity, "/transformers/brands/__reload", errArchiveResumed.Error()), rec.Body.String())
+	assert.Empty(t, s.replayedArchive)
+}
+
+func TestG2GFailsWhileStopping(t *testing.T) {
+	s := &dummyService{initialised: true, dataLoaded: true}
+	handler := NewBrandHandler(s)
+	assert.True(t, handler.G2GCheck().GoodToGo)
+	s.StopReloads()
+	assert.False(t, handler.G2GCheck().GoodToGo)
+}
+
+// brokenConnection - a response whose client has gone away, so writing the body fails
+type brokenConnection struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (w *brokenConnection) WriteHeader(status int) {
+	w.statuses = append(w.statuses, status)
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *brokenConnection) Write(p []byte) (int, error) {
+	if len(w.statuses) == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteJSONResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSONResponse(rec, newRequest("GET", "/transformers/brands/__audit"), map[string]interface{}{"unencodable": make(chan int)})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "An object that can't be encoded is a problem")
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+	broken := &brokenConnection{ResponseRecorder: httptest.NewRecorder()}
+	writeJSONResponse(broken, newRequest("GET", "/transformers/brands/__audit"), map[string]string{"status": "ok"})
+	assert.Equal(t, []int{http.StatusOK}, broken.statuses, "No problem is written once the body has started")
+	assert.Empty(t, broken.Header().Get("Content-Type"))
 }
 
 func newRequest(method, url string) *http.Request {
@@ -305,69 +602,121 @@ func newRequest(method, url string) *http.Request {
 	if err != nil {
 		panic(err)
 	}
+	req.Header.Set("X-Request-Id", testTransactionID)
+	req.Header.Set("X-Api-Key", testAPIKey)
 	return req
 }
 
+// problemResponse - the application/problem+json body of an error response to a request from newRequest
+func problemResponse(statusCode int, instance string, detail string, details ...string) string {
+	body := fmt.Sprintf(`{"type":"about:blank","title":%q,"status":%d,"detail":%q,"instance":%q,"transactionId":%q`, http.StatusText(statusCode), statusCode, detail, instance, testTransactionID)
+	if len(details) > 0 {
+		body += `,"details":["` + strings.Join(details, `","`) + `"]`
+	}
+	return body + "}\n"
+}
+
 type dummyService struct {
-	found        bool
-	brands       []brand
-	initialised  bool
-	dataLoaded   bool
-	count        int
-	err          error
-	loadDBCalled bool
-	wg           *sync.WaitGroup
+	found           bool
+	brands          []brand
+	initialised     bool
+	dataLoaded      bool
+	count           int
+	err             error
+	loadDBCalled    bool
+	wg              *sync.WaitGroup
+	uuidOverrides   map[string]string
+	canonicalUUID   string
+	archiveID       string
+	replayErr       error
+	replayedArchive string
+	startErr        error
+	lastReload      reloadResult
+	lastFetches     map[string]time.Time
+	quality         dataQuality
+	trigger         reloadTrigger
+	auditRecords    []json.RawMessage
+	quarantined     []quarantinedBrand
+	dump            *brandsDump
+	denied          []accessDenied
+	stopping        bool
+	reloading       bool
 }
 
-func (s *dummyService) loadCuratedBrands(bBrands []berthaBrand) error {
+func (s *dummyService) loadCuratedBrands(ctx context.Context, bBrands []berthaBrand) error {
 	return nil
 }
 
-func (s *dummyService) getBrands() (io.PipeReader, error) {
+func (s *dummyService) getBrands(ctx context.Context, filter brandFilter, fields fieldProjection) (*io.PipeReader, error) {
 	pv, pw := io.Pipe()
 	go func() {
-		encoder := json.NewEncoder(pw)
 		for _, sub := range s.brands {
-			encoder.Encode(sub)
+			if !filter.matches(sub) {
+				continue
+			}
+			projected, _ := projectBrand(sub, fields)
+			pw.Write(append(projected, '\n'))
 		}
 		pw.Close()
 	}()
-	return *pv, nil
+	return pv, nil
 }
 
-func (s *dummyService) getBrandUUIDs() (io.PipeReader, error) {
+func (s *dummyService) getBrandUUIDs(ctx context.Context, filter brandFilter) (*io.PipeReader, error) {
 	pv, pw := io.Pipe()
 	go func() {
 		encoder := json.NewEncoder(pw)
 		for _, sub := range s.brands {
+			if !filter.matches(sub) {
+				continue
+			}
 			encoder.Encode(brandUUID{UUID: sub.UUID})
 		}
 		pw.Close()
 	}()
-	return *pv, nil
+	return pv, nil
 }
 
-func (s *dummyService) getBrandLinks() (io.PipeReader, error) {
+func (s *dummyService) getBrandLinks(ctx context.Context) (*io.PipeReader, error) {
 	pv, pw := io.Pipe()
 	go func() {
-		var links []brandLink
+		encoder := json.NewEncoder(pw)
 		for _, sub := range s.brands {
-			links = append(links, brandLink{APIURL: "http://localhost:8080/transformers/brands/" + sub.UUID})
+			encoder.Encode(brandLink{APIURL: "http://localhost:8080/transformers/brands/" + sub.UUID})
 		}
-		b, _ := json.Marshal(links)
-		log.Infof("Writing bytes... %v", string(b))
-		pw.Write(b)
 		pw.Close()
 	}()
-	return *pv, nil
+	return pv, nil
 }
 
-func (s *dummyService) getCount() (int, error) {
+func (s *dummyService) getCount(ctx context.Context) (int, error) {
 	return s.count, s.err
 }
 
-func (s *dummyService) getBrandByUUID(uuid string) (brand, bool, error) {
-	return s.brands[0], s.found, nil
+func (s *dummyService) getCanonicalUUID(ctx context.Context, uuid string) (string, bool, error) {
+	return s.canonicalUUID, s.canonicalUUID != "", nil
+}
+
+func (s *dummyService) getConcordances(ctx context.Context) (*io.PipeReader, error) {
+	pv, pw := io.Pipe()
+	go func() {
+		encoder := json.NewEncoder(pw)
+		for _, sub := range s.brands {
+			for _, concordance := range buildConcordances(sub) {
+				encoder.Encode(concordance)
+			}
+		}
+		pw.Close()
+	}()
+	return pv, nil
+}
+
+func (s *dummyService) getUUIDOverrides() map[string]string {
+	return s.uuidOverrides
+}
+
+func (s *dummyService) getBrandByUUID(ctx context.Context, uuid string) (brand, bool, error) {
+	return s.brands[0], s.found, s.err
 }
 
 func (s *dummyService) isInitialised() bool {
@@ -378,42 +727,104 @@ func (s *dummyService) isDataLoaded() bool {
 	return s.dataLoaded
 }
 
-func (s *dummyService) Shutdown() error {
+func (s *dummyService) replayDB(ctx context.Context, archiveID string, trigger reloadTrigger) error {
+	defer s.wg.Done()
+	s.replayedArchive = archiveID
+	s.trigger = trigger
 	return s.err
 }
 
-func (s *dummyService) reloadDB() error {
-	defer s.wg.Done()
-	s.loadDBCalled = true
-	return s.err
+func (s *dummyService) canReplay(archiveID string) error {
+	if archiveID != s.archiveID {
+		return fmt.Errorf("Archive [%s] not found", archiveID)
+	}
+	return s.replayErr
 }
 
-func router(s BrandService) *mux.Router {
-	handler := NewBrandHandler(s)
-	servicesRouter := mux.NewRouter()
+func (s *dummyService) getLastFetch(dependency string) (time.Time, bool) {
+	fetched, found := s.lastFetches[dependency]
+	return fetched, found
+}
+
+func (s *dummyService) getAuditRecords(ctx context.Context, limit int) ([]json.RawMessage, error) {
+	if len(s.auditRecords) > limit {
+		return s.auditRecords[:limit], s.err
+	}
+	return s.auditRecords, s.err
+}
 
-	getBrandsSubrouter := servicesRouter.Path("/transformers/brands").Subrouter()
-	getBrandsSubrouter.Methods("GET").HandlerFunc(handler.GetBrands)
-	getBrandsSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+func (s *dummyService) getQuarantinedBrands(ctx context.Context) ([]quarantinedBrand, error) {
+	return s.quarantined, s.err
+}
 
-	brandCountSubrouter := servicesRouter.Path("/transformers/brands/__count").Subrouter()
-	brandCountSubrouter.Methods("GET").HandlerFunc(handler.GetCount)
-	brandCountSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+func (s *dummyService) getBrandsDump(encoding string) (io.ReadSeeker, string, time.Time, bool) {
+	if s.dump == nil || s.dump.encoded[encoding] == nil {
+		return nil, "", time.Time{}, false
+	}
+	return bytes.NewReader(s.dump.encoded[encoding]), s.dump.etag, s.dump.modified, true
+}
 
-	brandIDsSubrouter := servicesRouter.Path("/transformers/brands/__ids").Subrouter()
-	brandIDsSubrouter.Methods("GET").HandlerFunc(handler.GetBrandUUIDs)
-	brandIDsSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+func (s *dummyService) auditAccessDenied(record accessDenied) {
+	s.denied = append(s.denied, record)
+}
 
-	brandByUUIDSubrouter := servicesRouter.Path("/transformers/brands/{uuid:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}}").Subrouter()
-	brandByUUIDSubrouter.Methods("GET").HandlerFunc(handler.GetBrandByUUID)
-	brandByUUIDSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+func (s *dummyService) getDataQuality() dataQuality {
+	return s.quality
+}
 
-	reloadSubrouter := servicesRouter.Path("/transformers/brands/__reload").Subrouter()
-	reloadSubrouter.Methods("POST").HandlerFunc(handler.Reload)
-	reloadSubrouter.NewRoute().HandlerFunc(handler.OnlyPostAllowed)
+func (s *dummyService) getLastReload() reloadResult {
+	return s.lastReload
+}
+
+func (s *dummyService) cancelReload() bool {
+	return s.reloading
+}
 
-	servicesRouter.HandleFunc("/__health", v1a.Handler("V1 Brands Transformer Healthchecks", "Checks for the health of the service", handler.HealthCheck()))
-	g2gHandler := status.NewGoodToGoHandler(gtg.StatusChecker(handler.G2GCheck))
-	servicesRouter.HandleFunc(status.GTGPath, g2gHandler)
-	return servicesRouter
+func (s *dummyService) StopReloads() {
+	s.stopping = true
+}
+
+func (s *dummyService) isStopping() bool {
+	return s.stopping
+}
+
+func (s *dummyService) Shutdown() error {
+	return s.err
+}
+
+func (s *dummyService) startReloadDB(trigger reloadTrigger) error {
+	if s.startErr != nil {
+		return s.startErr
+	}
+	go s.reloadDB(context.Background(), trigger)
+	return nil
+}
+
+func (s *dummyService) startReplayDB(archiveID string, trigger reloadTrigger) error {
+	if s.startErr != nil {
+		return s.startErr
+	}
+	go s.replayDB(context.Background(), archiveID, trigger)
+	return nil
+}
+
+func (s *dummyService) reloadDB(ctx context.Context, trigger reloadTrigger) error {
+	defer s.wg.Done()
+	s.trigger = trigger
+	s.loadDBCalled = true
+	return s.err
+}
+
+// router - the service's router, with newRequest's API key given the admin role
+func router(s BrandService) *mux.Router {
+	auth, err := NewAuthenticator([]string{"test:" + testAPIKey + ":" + AdminRole}, "")
+	if err != nil {
+		panic(err)
+	}
+	return newRouter(s, auth, nil)
+}
+
+func newRouter(s BrandService, auth *Authenticator, limiter *RateLimiter) *mux.Router {
+	handler := NewBrandHandler(s)
+	return NewRouter(handler, auth, limiter, nil, []v1a.Check{handler.HealthCheck(), handler.ReloadHealthCheck()})
 }
@@ -0,0 +1,59 @@
+package brands
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "v1_brands_transformer"
+
+var (
+	tmePageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "tme_page_duration_seconds",
+		Help:      "Time taken to fetch a page of terms from TME, per attempt.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"taxonomy"})
+	tmePageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tme_page_errors_total",
+		Help:      "Failed attempts to fetch a page of terms from TME.",
+	}, []string{"taxonomy"})
+	tmeTermsPerPage = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "tme_terms_per_page",
+		Help:      "Number of terms in each page fetched from TME.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"taxonomy"})
+	batchWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "batch_write_duration_seconds",
+		Help:      "Time taken to write a batch of brands to the cache.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+	berthaFetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "bertha_fetch_duration_seconds",
+		Help:      "Time taken to read the curated brands from Bertha.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+	brandsByState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "brands",
+		Help:      "Number of brands in the cache after the last reload that served brands, by whether they are curated.",
+	}, []string{"state"})
+	reloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reload_duration_seconds",
+		Help:      "Time taken by reloads, by how they finished.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"status"})
+	requestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_shed_total",
+		Help:      "Requests turned away with a 429, by route and whether the rate or the concurrent streams limit was reached.",
+	}, []string{"route", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(tmePageDuration, tmePageErrors, tmeTermsPerPage, batchWriteDuration, berthaFetchDuration, brandsByState, reloadDuration, requestsShed)
+}
@@ -0,0 +1,36 @@
+package brands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadIsInstrumented(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	client := mockClient{resp: []berthaBrand{testBerthaBrandForFT}}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.Taxonomies[0].Name = "Metrics" }, withHTTPClient(&client))
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(brandsByState.WithLabelValues("curated")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(brandsByState.WithLabelValues("uncurated")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(tmePageErrors.WithLabelValues("Metrics")))
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `v1_brands_transformer_tme_page_duration_seconds_count{taxonomy="Metrics"} 2`)
+	assert.Contains(t, body, `v1_brands_transformer_tme_terms_per_page_count{taxonomy="Metrics"} 2`)
+	assert.Contains(t, body, "v1_brands_transformer_batch_write_duration_seconds_count")
+	assert.Contains(t, body, "v1_brands_transformer_bertha_fetch_duration_seconds_count")
+	assert.Contains(t, body, `v1_brands_transformer_reload_duration_seconds_count{status="succeeded"}`)
+}
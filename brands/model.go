@@ -15,12 +15,18 @@ type brand struct {
 	ParentUUID             string                 `json:"parentUUID,omitempty"`
 	PrefLabel              string                 `json:"prefLabel,omitempty"`
 	Type                   string                 `json:"type,omitempty"`
+	Taxonomy               string                 `json:"taxonomy,omitempty"`
 	AlternativeIdentifiers alternativeIdentifiers `json:"alternativeIdentifiers,omitempty"`
 	Aliases                []string               `json:"aliases,omitempty"`
 	Strapline              string                 `json:"strapline,omitempty"`
 	Description            string                 `json:"description,omitempty"`
 	DescriptionXML         string                 `json:"descriptionXML,omitempty"`
 	ImageURL               string                 `json:"_imageUrl,omitempty"`
+	BroaderUUIDs           []string               `json:"broaderUUIDs,omitempty"`
+	IsDeprecated           bool                   `json:"isDeprecated,omitempty"`
+	CreatedDate            string                 `json:"createdDate,omitempty"`
+	LastModifiedDate       string                 `json:"lastModifiedDate,omitempty"`
+	Uncurated              bool                   `json:"uncurated,omitempty"`
 }
 
 type alternativeIdentifiers struct {
@@ -35,3 +41,14 @@ type brandLink struct {
 type brandUUID struct {
 	UUID string `json:"ID"`
 }
+
+const (
+	uuidAuthority = "UUID"
+	tmeAuthority  = "TME"
+)
+
+type brandConcordance struct {
+	Identifier    string `json:"identifier"`
+	Authority     string `json:"authority"`
+	CanonicalUUID string `json:"canonicalUUID"`
+}
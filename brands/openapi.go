@@ -0,0 +1,407 @@
+package brands
+
+// apiDocument - the OpenAPI 3 description of every route registered by the router, served at /__api.
+// Keep it in step with the router: TestAPIDocumentDescribesEveryRoute fails for routes it doesn't describe.
+const apiDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "V1 Brands Transformer",
+    "description": "Transforms the V1 brands in TME, curated with the brands in Bertha, into UP brands",
+    "version": "1"
+  },
+  "paths": {
+    "/transformers/brands": {
+      "get": {
+        "summary": "All the brands, as NDJSON or a JSON array",
+        "description": "Without filters or fields, the dump built at the end of the last reload is served, compressed as Accept-Encoding prefers or not at all, with its Content-Length and ETag, and supports Range requests to resume a download.",
+        "tags": ["brands"],
+        "parameters": [
+          {"$ref": "#/components/parameters/parent"},
+          {"$ref": "#/components/parameters/curated"},
+          {"$ref": "#/components/parameters/hasImage"},
+          {"$ref": "#/components/parameters/hasDescription"},
+          {"$ref": "#/components/parameters/taxonomy"},
+          {"$ref": "#/components/parameters/modifiedSince"},
+          {"$ref": "#/components/parameters/fields"},
+          {"$ref": "#/components/parameters/format"}
+        ],
+        "responses": {
+          "200": {"description": "The brands", "headers": {"X-Stream-Error": {"$ref": "#/components/headers/streamError"}}, "content": {"application/x-ndjson": {"schema": {"$ref": "#/components/schemas/brand"}}, "application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/brand"}}}}},
+          "206": {"description": "Part of the dump of every brand, for a Range request without filters or fields"},
+          "400": {"$ref": "#/components/responses/badRequest"},
+          "404": {"$ref": "#/components/responses/notFound"},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"$ref": "#/components/responses/unavailable"}
+        }
+      }
+    },
+    "/transformers/brands/__count": {
+      "get": {
+        "summary": "The number of brands",
+        "tags": ["brands"],
+        "responses": {
+          "200": {"description": "The number of brands", "content": {"text/plain": {"schema": {"type": "integer"}}}},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"$ref": "#/components/responses/unavailable"}
+        }
+      }
+    },
+    "/transformers/brands/__ids": {
+      "get": {
+        "summary": "The UUID of every brand, as NDJSON or a JSON array",
+        "tags": ["brands"],
+        "parameters": [
+          {"$ref": "#/components/parameters/parent"},
+          {"$ref": "#/components/parameters/curated"},
+          {"$ref": "#/components/parameters/hasImage"},
+          {"$ref": "#/components/parameters/hasDescription"},
+          {"$ref": "#/components/parameters/taxonomy"},
+          {"$ref": "#/components/parameters/modifiedSince"},
+          {"$ref": "#/components/parameters/format"}
+        ],
+        "responses": {
+          "200": {"description": "The brand UUIDs", "headers": {"X-Stream-Error": {"$ref": "#/components/headers/streamError"}}, "content": {"application/x-ndjson": {"schema": {"$ref": "#/components/schemas/brandUUID"}}, "application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/brandUUID"}}}}},
+          "400": {"$ref": "#/components/responses/badRequest"},
+          "404": {"$ref": "#/components/responses/notFound"},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"$ref": "#/components/responses/unavailable"}
+        }
+      }
+    },
+    "/transformers/brands/__concordances": {
+      "get": {
+        "summary": "Every identifier of every brand mapped to its canonical UUID, as NDJSON or a JSON array",
+        "tags": ["brands"],
+        "parameters": [
+          {"$ref": "#/components/parameters/format"}
+        ],
+        "responses": {
+          "200": {"description": "The concordances", "headers": {"X-Stream-Error": {"$ref": "#/components/headers/streamError"}}, "content": {"application/x-ndjson": {"schema": {"$ref": "#/components/schemas/concordance"}}, "application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/concordance"}}}}},
+          "400": {"$ref": "#/components/responses/badRequest"},
+          "404": {"$ref": "#/components/responses/notFound"},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"$ref": "#/components/responses/unavailable"}
+        }
+      }
+    },
+    "/transformers/brands/__uuid-overrides": {
+      "get": {
+        "summary": "The TME identifier to UUID override table",
+        "tags": ["brands"],
+        "responses": {
+          "200": {"description": "The overrides", "content": {"application/json": {"schema": {"type": "object", "additionalProperties": {"type": "string", "format": "uuid"}}}}},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"$ref": "#/components/responses/unavailable"}
+        }
+      }
+    },
+    "/transformers/brands/{uuid}": {
+      "get": {
+        "summary": "A brand, redirecting alternative UUIDs to the canonical one",
+        "tags": ["brands"],
+        "parameters": [
+          {"name": "uuid", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}},
+          {"$ref": "#/components/parameters/fields"}
+        ],
+        "responses": {
+          "200": {"description": "The brand", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/brand"}}}},
+          "301": {"description": "The UUID is an alternative identifier of the brand at the Location header"},
+          "400": {"$ref": "#/components/responses/badRequest"},
+          "404": {"$ref": "#/components/responses/notFound"},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"$ref": "#/components/responses/unavailable"}
+        }
+      }
+    },
+    "/transformers/brands/__audit": {
+      "get": {
+        "summary": "The most recent reload and access denied audit records, newest first",
+        "tags": ["admin"],
+        "security": [{"apiKey": []}, {"bearerToken": []}],
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "default": 20}}
+        ],
+        "responses": {
+          "200": {"description": "The audit records", "content": {"application/json": {"schema": {"type": "array", "items": {"oneOf": [{"$ref": "#/components/schemas/reloadResult"}, {"$ref": "#/components/schemas/accessDenied"}]}}}}},
+          "400": {"$ref": "#/components/responses/badRequest"},
+          "401": {"$ref": "#/components/responses/unauthorized"},
+          "403": {"$ref": "#/components/responses/forbidden"},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"}
+        }
+      }
+    },
+    "/transformers/brands/__quarantine": {
+      "get": {
+        "summary": "The brands the last reloads kept out of the cache for violating the brand schema, when brand-validation is quarantine",
+        "tags": ["admin"],
+        "responses": {
+          "200": {"description": "The quarantined brands", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/quarantinedBrand"}}}}},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"}
+        }
+      }
+    },
+    "/transformers/brands/__reload": {
+      "get": {
+        "summary": "The result of the last reload, or the progress of the current one",
+        "tags": ["admin"],
+        "responses": {
+          "200": {"description": "The reload", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/reloadResult"}}}},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"}
+        }
+      },
+      "post": {
+        "summary": "Reload the brands from TME and Bertha, or from an archived reload",
+        "tags": ["admin"],
+        "security": [{"apiKey": []}, {"bearerToken": []}],
+        "parameters": [
+          {"name": "replay", "in": "query", "description": "The archived reload to replay, e.g. 20161018T155800.000Z", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "202": {"$ref": "#/components/responses/accepted"},
+          "401": {"$ref": "#/components/responses/unauthorized"},
+          "403": {"$ref": "#/components/responses/forbidden"},
+          "404": {"$ref": "#/components/responses/notFound"},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "409": {"description": "A reload is already in progress", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+          "422": {"description": "The archive is of a resumed reload, which cannot be replayed", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+          "429": {"$ref": "#/components/responses/tooManyRequests"},
+          "503": {"description": "The service is shutting down", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}}
+        }
+      },
+      "delete": {
+        "summary": "Cancel the running reload",
+        "tags": ["admin"],
+        "security": [{"apiKey": []}, {"bearerToken": []}],
+        "responses": {
+          "202": {"$ref": "#/components/responses/accepted"},
+          "401": {"$ref": "#/components/responses/unauthorized"},
+          "403": {"$ref": "#/components/responses/forbidden"},
+          "409": {"description": "No reload in progress", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+          "405": {"$ref": "#/components/responses/methodNotAllowed"},
+          "429": {"$ref": "#/components/responses/tooManyRequests"}
+        }
+      }
+    },
+    "/__health": {
+      "get": {
+        "summary": "FT standard healthchecks",
+        "tags": ["monitoring"],
+        "responses": {"200": {"description": "The healthchecks", "content": {"application/json": {"schema": {"type": "object"}}}}}
+      }
+    },
+    "/__gtg": {
+      "get": {
+        "summary": "Whether the service is good to go",
+        "tags": ["monitoring"],
+        "responses": {
+          "200": {"description": "Good to go"},
+          "503": {"description": "Not good to go"}
+        }
+      }
+    },
+    "/__ping": {
+      "get": {"summary": "Ping", "tags": ["monitoring"], "responses": {"200": {"description": "pong"}}}
+    },
+    "/ping": {
+      "get": {"summary": "Ping", "tags": ["monitoring"], "responses": {"200": {"description": "pong"}}}
+    },
+    "/__build-info": {
+      "get": {"summary": "The build of the service", "tags": ["monitoring"], "responses": {"200": {"description": "The build", "content": {"application/json": {"schema": {"type": "object"}}}}}}
+    },
+    "/build-info": {
+      "get": {"summary": "The build of the service", "tags": ["monitoring"], "responses": {"200": {"description": "The build", "content": {"application/json": {"schema": {"type": "object"}}}}}}
+    },
+    "/metrics": {
+      "get": {"summary": "Prometheus metrics", "tags": ["monitoring"], "responses": {"200": {"description": "The metrics", "content": {"text/plain": {"schema": {"type": "string"}}}}}}
+    },
+    "/__api": {
+      "get": {"summary": "This document", "tags": ["monitoring"], "responses": {"200": {"description": "The OpenAPI document", "content": {"application/json": {"schema": {"type": "object"}}}}}}
+    },
+    "/__schema/brand": {
+      "get": {"summary": "The JSON Schema of the brands", "tags": ["monitoring"], "responses": {"200": {"description": "The JSON Schema", "content": {"application/schema+json": {"schema": {"type": "object"}}}}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "brand": {
+        "type": "object",
+        "description": "The JSON Schema at /__schema/brand is the full contract",
+        "required": ["uuid"],
+        "properties": {
+          "uuid": {"type": "string", "format": "uuid"},
+          "parentUUID": {"type": "string", "format": "uuid"},
+          "prefLabel": {"type": "string"},
+          "type": {"type": "string"},
+          "taxonomy": {"type": "string", "description": "The TME taxonomy the brand came from"},
+          "alternativeIdentifiers": {
+            "type": "object",
+            "properties": {
+              "TME": {"type": "array", "items": {"type": "string"}},
+              "uuids": {"type": "array", "items": {"type": "string", "format": "uuid"}}
+            }
+          },
+          "aliases": {"type": "array", "items": {"type": "string"}},
+          "strapline": {"type": "string"},
+          "description": {"type": "string"},
+          "descriptionXML": {"type": "string"},
+          "_imageUrl": {"type": "string"},
+          "broaderUUIDs": {"type": "array", "items": {"type": "string", "format": "uuid"}},
+          "isDeprecated": {"type": "boolean"},
+          "createdDate": {"type": "string"},
+          "lastModifiedDate": {"type": "string"},
+          "uncurated": {"type": "boolean", "description": "The brand has no curated information from Bertha"}
+        }
+      },
+      "brandUUID": {
+        "type": "object",
+        "required": ["ID"],
+        "properties": {"ID": {"type": "string", "format": "uuid"}}
+      },
+      "brandLink": {
+        "type": "object",
+        "required": ["apiUrl"],
+        "properties": {"apiUrl": {"type": "string", "format": "uri"}}
+      },
+      "concordance": {
+        "type": "object",
+        "required": ["identifier", "authority", "canonicalUUID"],
+        "properties": {
+          "identifier": {"type": "string"},
+          "authority": {"type": "string", "enum": ["UUID", "TME"]},
+          "canonicalUUID": {"type": "string", "format": "uuid"}
+        }
+      },
+      "reloadResult": {
+        "type": "object",
+        "required": ["job", "status", "berthaFailurePolicy", "curated", "started", "counts"],
+        "properties": {
+          "transactionId": {"type": "string"},
+          "trigger": {"type": "string", "enum": ["startup", "request"]},
+          "caller": {"type": "string"},
+          "job": {"type": "string"},
+          "status": {"type": "string", "enum": ["in progress", "succeeded", "degraded", "failed"]},
+          "berthaFailurePolicy": {"type": "string", "enum": ["fail", "tme-only", "previous-curated"]},
+          "curated": {"type": "boolean"},
+          "started": {"type": "string", "format": "date-time"},
+          "finished": {"type": "string", "format": "date-time"},
+          "counts": {
+            "type": "object",
+            "properties": {
+              "tmeBrands": {"type": "integer"},
+              "berthaRows": {"type": "integer"},
+              "curatedBrands": {"type": "integer"},
+              "curatedOnlyBrands": {"type": "integer"},
+              "skippedBerthaRows": {"type": "integer"},
+              "invalidBrands": {"type": "integer"},
+              "brands": {"type": "integer"},
+              "uncuratedBrands": {"type": "integer"}
+            }
+          },
+          "warnings": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "uuid": {"type": "string", "format": "uuid"},
+                "prefLabel": {"type": "string"},
+                "tmeIdentifier": {"type": "string"},
+                "message": {"type": "string"}
+              }
+            }
+          },
+          "errors": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "quarantinedBrand": {
+        "type": "object",
+        "properties": {
+          "brand": {"$ref": "#/components/schemas/brand"},
+          "violations": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "accessDenied": {
+        "type": "object",
+        "properties": {
+          "event": {"type": "string", "enum": ["access-denied"]},
+          "transactionId": {"type": "string"},
+          "caller": {"type": "string"},
+          "principal": {"type": "string"},
+          "method": {"type": "string"},
+          "path": {"type": "string"},
+          "reason": {"type": "string"},
+          "time": {"type": "string", "format": "date-time"}
+        }
+      },
+      "message": {
+        "type": "object",
+        "properties": {"message": {"type": "string"}}
+      },
+      "problem": {
+        "type": "object",
+        "description": "An RFC 7807 problem, the body of every error response",
+        "required": ["type", "title", "status", "transactionId"],
+        "properties": {
+          "type": {"type": "string", "format": "uri"},
+          "title": {"type": "string"},
+          "status": {"type": "integer"},
+          "detail": {"type": "string"},
+          "instance": {"type": "string"},
+          "transactionId": {"type": "string"},
+          "details": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "parameters": {
+      "format": {"name": "format", "in": "query", "description": "ndjson, one JSON object per line, or json-array, a JSON array. Overrides the Accept header, and ndjson is the default unless Accept allows application/json but not application/x-ndjson", "schema": {"type": "string", "enum": ["ndjson", "json-array"]}},
+      "parent": {"name": "parent", "in": "query", "description": "Only the brands with this parent UUID", "schema": {"type": "string", "format": "uuid"}},
+      "curated": {"name": "curated", "in": "query", "description": "Only the brands with, or without, curated information from Bertha", "schema": {"type": "boolean"}},
+      "hasImage": {"name": "hasImage", "in": "query", "description": "Only the brands with, or without, an image", "schema": {"type": "boolean"}},
+      "hasDescription": {"name": "hasDescription", "in": "query", "description": "Only the brands with, or without, a description", "schema": {"type": "boolean"}},
+      "taxonomy": {"name": "taxonomy", "in": "query", "description": "Only the brands from this TME taxonomy", "schema": {"type": "string"}},
+      "modifiedSince": {"name": "modifiedSince", "in": "query", "description": "Only the brands last modified in TME at or after this RFC3339 time or date", "schema": {"type": "string"}},
+      "fields": {
+        "name": "fields",
+        "in": "query",
+        "description": "Comma separated top level brand fields to limit each brand to, e.g. uuid,prefLabel,parentUUID",
+        "style": "form",
+        "explode": false,
+        "schema": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    "headers": {
+      "streamError": {"description": "Trailer set when the listing failed part way through, when a JSON array is also left unterminated", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "accepted": {"description": "Accepted", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/message"}}}},
+      "badRequest": {"description": "Invalid parameters", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+      "unauthorized": {"description": "Missing or invalid credentials", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+      "forbidden": {"description": "The credentials don't have the admin role", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+      "methodNotAllowed": {
+        "description": "The method isn't allowed, the Allow header and the problem's details give the methods that are",
+        "headers": {"Allow": {"schema": {"type": "string"}}},
+        "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}
+      },
+      "notFound": {"description": "Not found", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}},
+      "tooManyRequests": {
+        "description": "A rate limit, or the limit of concurrent full listings, was reached",
+        "headers": {"Retry-After": {"schema": {"type": "integer"}, "description": "Seconds to wait before retrying"}},
+        "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}
+      },
+      "unavailable": {"description": "The brands are still loading", "content": {"application/problem+json": {"schema": {"$ref": "#/components/schemas/problem"}}}}
+    },
+    "securitySchemes": {
+      "apiKey": {"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+      "bearerToken": {"type": "http", "scheme": "bearer", "description": "An HMAC-SHA256 signed token, see brands.SignToken"}
+    }
+  }
+}
+`
@@ -0,0 +1,75 @@
+package brands
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestAPIDocumentIsServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	router(&dummyService{}).ServeHTTP(rec, newRequest("GET", "/__api"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var doc openAPIDocument
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.True(t, strings.HasPrefix(doc.OpenAPI, "3."))
+	for _, schema := range []string{"brand", "brandUUID", "brandLink"} {
+		assert.Contains(t, doc.Components.Schemas, schema)
+	}
+}
+
+var pathVariable = regexp.MustCompile(`\{(\w+):[^/]*\}`)
+
+func TestAPIDocumentDescribesEveryRoute(t *testing.T) {
+	var doc openAPIDocument
+	if !assert.NoError(t, json.Unmarshal([]byte(apiDocument), &doc)) {
+		return
+	}
+
+	methodsByPath := make(map[string]map[string]bool)
+	router(&dummyService{}).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+		path := pathVariable.ReplaceAllString(template, "{$1}")
+		if methodsByPath[path] == nil {
+			methodsByPath[path] = make(map[string]bool)
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			methodsByPath[path][strings.ToLower(method)] = true
+		}
+		return nil
+	})
+
+	assert.NotEmpty(t, methodsByPath)
+	for path, methods := range methodsByPath {
+		if len(methods) == 0 {
+			methods["get"] = true
+		}
+		operations, found := doc.Paths[path]
+		if !assert.True(t, found, "%s is not in the API document", path) {
+			continue
+		}
+		for method := range methods {
+			assert.Contains(t, operations, method, "%s %s is not in the API document", strings.ToUpper(method), path)
+		}
+	}
+}
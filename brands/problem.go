@@ -0,0 +1,57 @@
+package brands
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+	log "github.com/Sirupsen/logrus"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem - an RFC 7807 problem details object, the body of every error response.
+// Status is the HTTP status code, and Detail the message explaining this occurrence of the problem.
+type problem struct {
+	Type          string   `json:"type"`
+	Title         string   `json:"title"`
+	Status        int      `json:"status"`
+	Detail        string   `json:"detail,omitempty"`
+	Instance      string   `json:"instance,omitempty"`
+	TransactionID string   `json:"transactionId"`
+	Details       []string `json:"details,omitempty"`
+}
+
+func newProblem(req *http.Request, statusCode int, detail string, details ...string) problem {
+	return problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(statusCode),
+		Status:        statusCode,
+		Detail:        detail,
+		Instance:      req.URL.Path,
+		TransactionID: transactionidutils.GetTransactionIDFromRequest(req),
+		Details:       details,
+	}
+}
+
+// writeProblem - write an application/problem+json error response with the status code, detail and any further details
+func writeProblem(writer http.ResponseWriter, req *http.Request, statusCode int, detail string, details ...string) {
+	writer.Header().Set("Content-Type", problemContentType)
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(newProblem(req, statusCode, detail, details...)); err != nil {
+		log.Errorf("Error writing the %d problem response: %v", statusCode, err.Error())
+	}
+}
+
+// NotFound - the problem response for requests that match no route
+func (h *BrandHandler) NotFound(writer http.ResponseWriter, req *http.Request) {
+	writeProblem(writer, req, http.StatusNotFound, "No such endpoint "+req.URL.Path)
+}
+
+// methodNotAllowed - the problem response for a method the route doesn't support, with the Allow header and the allowed methods as its details
+func methodNotAllowed(writer http.ResponseWriter, req *http.Request, allowed ...string) {
+	allow := strings.Join(allowed, ", ")
+	writer.Header().Set("Allow", allow)
+	writeProblem(writer, req, http.StatusMethodNotAllowed, "Method "+req.Method+" is not allowed, expected "+allow, allowed...)
+}
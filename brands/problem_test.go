@@ -0,0 +1,41 @@
+package brands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemsAreValidJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	router(&dummyService{initialised: true, dataLoaded: true}).ServeHTTP(rec, newRequest("GET", `/transformers/brands?fields=uuid,%22name%22`))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+	var p problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p), rec.Body.String())
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "Bad Request", p.Title)
+	assert.Contains(t, p.Detail, `Unknown field "name"`)
+	assert.Equal(t, testTransactionID, p.TransactionID)
+}
+
+func TestBrandByUUIDFailureIsOnlyAProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := &dummyService{initialised: true, dataLoaded: true, found: true, brands: []brand{{UUID: testUUID}}, err: errors.New("Cache read failed")}
+	router(s).ServeHTTP(rec, newRequest("GET", "/transformers/brands/"+testUUID))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, problemResponse(http.StatusInternalServerError, "/transformers/brands/"+testUUID, "Cache read failed"), rec.Body.String())
+}
+
+func TestMethodNotAllowedIsAProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	router(&dummyService{initialised: true}).ServeHTTP(rec, newRequest("PATCH", "/transformers/brands/__reload"))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, POST, DELETE", rec.Header().Get("Allow"))
+	assert.Equal(t, problemResponse(http.StatusMethodNotAllowed, "/transformers/brands/__reload", "Method PATCH is not allowed, expected GET, POST, DELETE", "GET", "POST", "DELETE"), rec.Body.String())
+}
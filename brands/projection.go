@@ -0,0 +1,86 @@
+package brands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// brandFields - the JSON names of the brand fields, in the order a brand is written
+var brandFields = jsonFieldNames(reflect.TypeOf(brand{}))
+
+func jsonFieldNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+	return names
+}
+
+// fieldProjection - the top level brand fields a response is limited to, in brand order. Nil is every field.
+type fieldProjection []string
+
+// parseFieldProjection - parse a comma separated list of brand fields, e.g. uuid,prefLabel,parentUUID
+func parseFieldProjection(param string) (fieldProjection, error) {
+	if param == "" {
+		return nil, nil
+	}
+	requested := make(map[string]bool)
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isBrandField(name) {
+			return nil, fmt.Errorf("Unknown field %s, expected any of %s", name, strings.Join(brandFields, ","))
+		}
+		requested[name] = true
+	}
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	fields := make(fieldProjection, 0, len(requested))
+	for _, name := range brandFields {
+		if requested[name] {
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+func isBrandField(name string) bool {
+	for _, field := range brandFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// project - the brand as written in the cache, limited to the fields. Fields the brand omits stay omitted.
+func (p fieldProjection) project(cached []byte) ([]byte, error) {
+	if p == nil {
+		return cached, nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(cached, &values); err != nil {
+		return nil, err
+	}
+	var projected bytes.Buffer
+	projected.WriteByte('{')
+	for _, name := range p {
+		value, found := values[name]
+		if !found {
+			continue
+		}
+		if projected.Len() > 1 {
+			projected.WriteByte(',')
+		}
+		projected.WriteString(`"` + name + `":`)
+		projected.Write(value)
+	}
+	projected.WriteByte('}')
+	return projected.Bytes(), nil
+}
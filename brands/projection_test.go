@@ -0,0 +1,43 @@
+package brands
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldProjection(t *testing.T) {
+	fields, err := parseFieldProjection("parentUUID, uuid,prefLabel,uuid")
+	assert.NoError(t, err)
+	assert.Equal(t, fieldProjection{"uuid", "parentUUID", "prefLabel"}, fields)
+
+	fields, err = parseFieldProjection("")
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+
+	_, err = parseFieldProjection("uuid,alternativeIdentifiers.TME")
+	assert.Error(t, err)
+}
+
+func TestProjectedBrandsAreStreamed(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+
+	fields, _ := parseFieldProjection("uuid,prefLabel,parentUUID")
+	pv, err := service.getBrands(context.Background(), brandFilter{}, fields)
+	if !assert.NoError(t, err) {
+		return
+	}
+	scanner := bufio.NewScanner(pv)
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, `{"uuid":"`+bobUuid+`","parentUUID":"`+financialTimesBrandUuid+`","prefLabel":"Bob"}`, scanner.Text())
+	assert.False(t, scanner.Scan())
+}
@@ -0,0 +1,86 @@
+package brands
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientAddressKey struct{}
+
+// TrustedProxies - the networks of the proxies, such as load balancers, trusted to append the address they received a
+// request from to its X-Forwarded-For header. Entries added by anyone else can be forged, so they are never believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies - parse the trusted proxies given as CIDR ranges, e.g. 10.0.0.0/8, or single addresses
+func ParseTrustedProxies(specs []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid trusted proxy [%s], expected an address or CIDR range", spec)
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy [%s]: %v", spec, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) trusts(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware - work out the address each request came from before passing it on to next, for the rate limits and audit
+func (p TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), clientAddressKey{}, p.clientAddress(req))))
+	})
+}
+
+// clientAddress - the address of the connection, or while that is a trusted proxy the rightmost X-Forwarded-For entry
+// it added, stopping at the first address that isn't trusted
+func (p TrustedProxies) clientAddress(req *http.Request) string {
+	address := remoteHost(req)
+	hops := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0 && p.trusts(address); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		address = hop
+	}
+	return address
+}
+
+// clientAddress - the address the request came from, as worked out by TrustedProxies.Middleware, or else the address of the connection
+func clientAddress(req *http.Request) string {
+	if address, found := req.Context().Value(clientAddressKey{}).(string); found {
+		return address
+	}
+	return remoteHost(req)
+}
+
+func remoteHost(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
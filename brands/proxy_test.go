@@ -0,0 +1,65 @@
+package brands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.0.1", "::1"})
+	assert.NoError(t, err)
+	assert.True(t, proxies.trusts("10.1.2.3"))
+	assert.True(t, proxies.trusts("192.168.0.1"))
+	assert.False(t, proxies.trusts("192.168.0.2"))
+	assert.True(t, proxies.trusts("::1"))
+	assert.False(t, proxies.trusts("not an address"))
+
+	for _, spec := range []string{"10.0.0.0/33", "proxy", ""} {
+		_, err := ParseTrustedProxies([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		proxies    TrustedProxies
+		expected   string
+	}{
+		{"NoProxies", "10.0.0.1:1234", []string{"192.168.0.1"}, nil, "10.0.0.1"},
+		{"NotForwarded", "10.0.0.1:1234", nil, proxies, "10.0.0.1"},
+		{"UntrustedConnection", "172.16.0.1:1234", []string{"192.168.0.1"}, proxies, "172.16.0.1"},
+		{"TrustedProxy", "10.0.0.1:1234", []string{"192.168.0.1"}, proxies, "192.168.0.1"},
+		{"ForgedEntry", "10.0.0.1:1234", []string{"1.2.3.4, 192.168.0.1"}, proxies, "192.168.0.1"},
+		{"ChainOfTrustedProxies", "10.0.0.1:1234", []string{"1.2.3.4, 192.168.0.1, 10.0.0.2"}, proxies, "192.168.0.1"},
+		{"SeveralHeaders", "10.0.0.1:1234", []string{"1.2.3.4", "192.168.0.1"}, proxies, "192.168.0.1"},
+		{"OnlyTrustedProxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, proxies, "10.0.0.3"},
+		{"EmptyEntry", "10.0.0.1:1234", []string{"192.168.0.1, "}, proxies, "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		req := newRequest("GET", "/transformers/brands")
+		req.RemoteAddr = test.remoteAddr
+		for _, forwarded := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+		var address string
+		test.proxies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			address = clientAddress(r)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, test.expected, address, test.name)
+	}
+}
+
+func TestClientAddressWithoutMiddleware(t *testing.T) {
+	req := newRequest("GET", "/transformers/brands")
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.168.0.1")
+	assert.Equal(t, "10.0.0.1", clientAddress(req))
+}
@@ -0,0 +1,79 @@
+package brands
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+// DataQualityThresholds - the limits beyond which the data freshness and quality health checks fail
+type DataQualityThresholds struct {
+	ReloadSLA           time.Duration
+	MaxCountDropPercent float64
+	MaxUncuratedPercent float64
+}
+
+// dataQuality - figures computed from the cache at the end of every reload that served brands
+type dataQuality struct {
+	LastLoaded        time.Time
+	Count             int
+	PreviousCount     int
+	Uncurated         int
+	OrphanParents     []string
+	SkippedBerthaRows int
+}
+
+func (s *brandServiceImpl) getDataQuality() dataQuality {
+	s.RLock()
+	defer s.RUnlock()
+	return s.quality
+}
+
+// updateDataQuality - recompute the data quality figures from the cache, keeping the count of the previous generation
+func (s *brandServiceImpl) updateDataQuality() {
+	var q dataQuality
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(cacheBucket))
+		if bucket == nil {
+			return fmt.Errorf("Bucket %v not found!", cacheBucket)
+		}
+		orphans := make(map[string]bool)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var cachedBrand brand
+			if err := json.Unmarshal(v, &cachedBrand); err != nil {
+				return err
+			}
+			q.Count++
+			if cachedBrand.Uncurated {
+				q.Uncurated++
+			}
+			if cachedBrand.ParentUUID != "" && bucket.Get([]byte(cachedBrand.ParentUUID)) == nil {
+				orphans[cachedBrand.ParentUUID] = true
+			}
+			return nil
+		})
+		for parentUUID := range orphans {
+			q.OrphanParents = append(q.OrphanParents, parentUUID)
+		}
+		sort.Strings(q.OrphanParents)
+		return err
+	})
+	if err != nil {
+		log.Warnf("Cannot compute data quality of the cache: %v", err.Error())
+		return
+	}
+
+	brandsByState.WithLabelValues("curated").Set(float64(q.Count - q.Uncurated))
+	brandsByState.WithLabelValues("uncurated").Set(float64(q.Uncurated))
+
+	s.Lock()
+	defer s.Unlock()
+	q.LastLoaded = time.Now().UTC()
+	q.PreviousCount = s.quality.Count
+	q.SkippedBerthaRows = s.lastReload.Counts.SkippedBerthaRows
+	s.quality = q
+}
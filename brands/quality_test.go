@@ -0,0 +1,72 @@
+package brands
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataQualityAfterReload(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{
+		{CanonicalName: "Bob", RawID: "bob"},
+		{CanonicalName: "Fred", RawID: "fred", Parent: &relatedTerm{CanonicalName: "Missing", RawID: "missing"}},
+	}}
+	client := mockClient{resp: []berthaBrand{testBerthaBrandForFT, {PrefLabel: "No TME identifier"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&client))
+	defer service.Shutdown()
+
+	waitTillReloadFinished(t, service)
+	quality := service.getDataQuality()
+	assert.WithinDuration(t, time.Now(), quality.LastLoaded, time.Minute)
+	assert.Equal(t, 3, quality.Count)
+	assert.Equal(t, 0, quality.PreviousCount)
+	assert.Equal(t, 2, quality.Uncurated)
+	assert.Equal(t, []string{tmeUUID(buildTmeIdentifier("missing", "Brands"), nil)}, quality.OrphanParents)
+	assert.Equal(t, 1, quality.SkippedBerthaRows)
+
+	repo.terms = repo.terms[:1]
+	repo.count = 0
+	assert.NoError(t, service.reloadDB(context.Background(), reloadTrigger{}))
+	quality = service.getDataQuality()
+	assert.Equal(t, 2, quality.Count)
+	assert.Equal(t, 3, quality.PreviousCount)
+	assert.Empty(t, quality.OrphanParents)
+}
+
+func TestDataQualityHealthChecks(t *testing.T) {
+	thresholds := DataQualityThresholds{ReloadSLA: time.Hour, MaxCountDropPercent: 10, MaxUncuratedPercent: 50}
+	handler := NewBrandHandler(&dummyService{quality: dataQuality{
+		LastLoaded:        time.Now().Add(-2 * time.Hour),
+		Count:             80,
+		PreviousCount:     100,
+		Uncurated:         20,
+		OrphanParents:     []string{testUUID},
+		SkippedBerthaRows: 2,
+	}})
+
+	_, err := handler.DataFreshnessHealthCheck(thresholds).Checker()
+	assert.Regexp(t, "beyond the SLA of 1h0m0s$", err.Error())
+	_, err = handler.BrandCountHealthCheck(thresholds).Checker()
+	assert.EqualError(t, err, "80 brands loaded, down 20.0% from 100")
+	output, err := handler.UncuratedBrandsHealthCheck(thresholds).Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "20 of 80 brands (25.0%) are uncurated", output)
+	_, err = handler.OrphanParentsHealthCheck().Checker()
+	assert.EqualError(t, err, "1 parent brands are missing: "+testUUID)
+	_, err = handler.SkippedBerthaRowsHealthCheck().Checker()
+	assert.EqualError(t, err, "2 curated brands were skipped for a missing TME identifier")
+}
+
+func TestDataFreshnessHealthCheckBeforeFirstReload(t *testing.T) {
+	handler := NewBrandHandler(&dummyService{})
+	_, err := handler.DataFreshnessHealthCheck(DataQualityThresholds{ReloadSLA: time.Hour}).Checker()
+	assert.EqualError(t, err, "No reload has served brands yet")
+	output, err := handler.BrandCountHealthCheck(DataQualityThresholds{}).Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "0 brands loaded, no previous reload to compare with", output)
+}
@@ -0,0 +1,238 @@
+package brands
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	globalClient      = ""
+	bucketPruneEvery  = time.Minute
+	bucketIdleAfter   = time.Minute
+	streamRetryAfter  = 10 * time.Second
+	rateLimitedReason = "rate"
+	streamsFullReason = "streams"
+)
+
+// RateLimitedRoutes - the routes that can be given rate limits
+var RateLimitedRoutes = []string{"brands", "ids", "concordances", "count", "uuid-overrides", "brand", "audit", "quarantine", "reload-status", "reload"}
+
+// DefaultRateLimits - the limits on the full listings when none are given, as each holds a read transaction of the
+// cache open while it streams
+var DefaultRateLimits = []string{"brands=6/60", "ids=6/60", "concordances=6/60"}
+
+// RateLimit - requests a minute allowed on a route from each client and from all clients together, zero for no limit
+type RateLimit struct {
+	PerClient int
+	Global    int
+}
+
+// ParseRateLimits - parse route=perClient/global limits, e.g. brands=6/60. Either side may be left empty for no limit
+func ParseRateLimits(specs []string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid rate limit [%s], expected route=perClient/global", spec)
+		}
+		if !isRateLimitedRoute(parts[0]) {
+			return nil, fmt.Errorf("Invalid rate limit [%s], unknown route %s, expected one of %s", spec, parts[0], strings.Join(RateLimitedRoutes, ", "))
+		}
+		rates := strings.SplitN(parts[1], "/", 2)
+		if len(rates) != 2 {
+			return nil, fmt.Errorf("Invalid rate limit [%s], expected route=perClient/global", spec)
+		}
+		var limit RateLimit
+		var err error
+		if limit.PerClient, err = parseRate(rates[0]); err != nil {
+			return nil, fmt.Errorf("Invalid rate limit [%s]: %v", spec, err)
+		}
+		if limit.Global, err = parseRate(rates[1]); err != nil {
+			return nil, fmt.Errorf("Invalid rate limit [%s]: %v", spec, err)
+		}
+		limits[parts[0]] = limit
+	}
+	return limits, nil
+}
+
+func isRateLimitedRoute(route string) bool {
+	for _, r := range RateLimitedRoutes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRate(rate string) (int, error) {
+	if rate == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(rate)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative rate %d", n)
+	}
+	return n, err
+}
+
+// tokenBucket - holds up to a minute's worth of requests, refilled continuously
+type tokenBucket struct {
+	perMinute int
+	tokens    float64
+	updated   time.Time
+	used      time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.perMinute), b.tokens+now.Sub(b.updated).Minutes()*float64(b.perMinute))
+	b.updated = now
+}
+
+// take - take a token if there is one, otherwise say how long until there will be
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	b.used = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / float64(b.perMinute) * float64(time.Minute))
+}
+
+// RateLimiter - sheds requests beyond the rate limits of their route, and full listings beyond the number that may stream at once
+type RateLimiter struct {
+	sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]map[string]*tokenBucket
+	pruned  time.Time
+	streams chan struct{}
+	now     func() time.Time
+}
+
+// NewRateLimiter - create a RateLimiter for the routes' limits allowing maxStreams concurrent full listings, zero for no cap
+func NewRateLimiter(limits map[string]RateLimit, maxStreams int) *RateLimiter {
+	l := &RateLimiter{
+		limits:  limits,
+		buckets: make(map[string]map[string]*tokenBucket),
+		now:     time.Now,
+	}
+	if maxStreams > 0 {
+		l.streams = make(chan struct{}, maxStreams)
+	}
+	return l
+}
+
+// Limit - only let requests within the route's rate limits through to next. A nil RateLimiter lets everyone through.
+func (l *RateLimiter) Limit(route string, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if allowed, retryAfter := l.allow(route, clientAddress(req)); !allowed {
+			shed(writer, req, route, rateLimitedReason, retryAfter)
+			return
+		}
+		next(writer, req)
+	}
+}
+
+// LimitStream - as Limit, also shedding full listings while the maximum number are already streaming
+func (l *RateLimiter) LimitStream(route string, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return l.Limit(route, func(writer http.ResponseWriter, req *http.Request) {
+		if l.streams == nil {
+			next(writer, req)
+			return
+		}
+		select {
+		case l.streams <- struct{}{}:
+			defer func() { <-l.streams }()
+			next(writer, req)
+		default:
+			shed(writer, req, route, streamsFullReason, streamRetryAfter)
+		}
+	})
+}
+
+func (l *RateLimiter) allow(route string, client string) (bool, time.Duration) {
+	limit, found := l.limits[route]
+	if !found || (limit.PerClient == 0 && limit.Global == 0) {
+		return true, 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	l.pruneBuckets(now)
+
+	var global, perClient *tokenBucket
+	if limit.Global > 0 {
+		global = l.bucket(route, globalClient, limit.Global, now)
+		global.refill(now)
+	}
+	if limit.PerClient > 0 {
+		perClient = l.bucket(route, client, limit.PerClient, now)
+		if allowed, retryAfter := perClient.take(now); !allowed {
+			return false, retryAfter
+		}
+	}
+	if global != nil {
+		if allowed, retryAfter := global.take(now); !allowed {
+			// the client's token wasn't used, so give it back
+			if perClient != nil {
+				perClient.tokens++
+			}
+			return false, retryAfter
+		}
+	}
+	return true, 0
+}
+
+func (l *RateLimiter) bucket(route string, client string, perMinute int, now time.Time) *tokenBucket {
+	clients, found := l.buckets[route]
+	if !found {
+		clients = make(map[string]*tokenBucket)
+		l.buckets[route] = clients
+	}
+	b, found := clients[client]
+	if !found {
+		b = &tokenBucket{perMinute: perMinute, tokens: float64(perMinute), updated: now, used: now}
+		clients[client] = b
+	}
+	return b
+}
+
+// pruneBuckets - forget the buckets that haven't been used for a while, as they have filled up again and are no
+// different from new ones, so the buckets don't grow with every client ever seen
+func (l *RateLimiter) pruneBuckets(now time.Time) {
+	if now.Sub(l.pruned) < bucketPruneEvery {
+		return
+	}
+	l.pruned = now
+	for route, clients := range l.buckets {
+		for client, b := range clients {
+			if now.Sub(b.used) >= bucketIdleAfter {
+				delete(clients, client)
+			}
+		}
+		if len(clients) == 0 {
+			delete(l.buckets, route)
+		}
+	}
+}
+
+func shed(writer http.ResponseWriter, req *http.Request, route string, reason string, retryAfter time.Duration) {
+	requestsShed.WithLabelValues(route, reason).Inc()
+	log.Warnf("Shedding %s %s from %s: %s limit reached", req.Method, req.URL.Path, clientAddress(req), reason)
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeProblem(writer, req, http.StatusTooManyRequests, "Too many requests to "+route+", the "+reason+" limit was reached")
+}
@@ -0,0 +1,165 @@
+package brands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits([]string{"brands=6/60", "reload=/2", "count=10/"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]RateLimit{
+		"brands": {PerClient: 6, Global: 60},
+		"reload": {Global: 2},
+		"count":  {PerClient: 10},
+	}, limits)
+
+	for _, spec := range []string{"brands", "brands=6", "=6/60", "brands=x/60", "brands=-1/60", "brandz=6/60"} {
+		_, err := ParseRateLimits([]string{spec})
+		assert.Error(t, err, spec)
+	}
+
+	limits, err = ParseRateLimits(DefaultRateLimits)
+	assert.NoError(t, err)
+	for _, route := range []string{"brands", "ids", "concordances"} {
+		assert.NotZero(t, limits[route].PerClient, route)
+		assert.NotZero(t, limits[route].Global, route)
+	}
+}
+
+func TestEveryRateLimitedRouteCanBeLimited(t *testing.T) {
+	for _, route := range RateLimitedRoutes {
+		_, err := ParseRateLimits([]string{route + "=1/2"})
+		assert.NoError(t, err, route)
+	}
+}
+
+func fixedClock(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+func limitedRequest(l *RateLimiter, route string, client string) *httptest.ResponseRecorder {
+	req := newRequest("GET", "/transformers/brands")
+	req.RemoteAddr = client + ":1234"
+	rec := httptest.NewRecorder()
+	l.Limit(route, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(rec, req)
+	return rec
+}
+
+func TestPerClientRateLimit(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(map[string]RateLimit{"brands": {PerClient: 2}}, 0)
+	l.now = fixedClock(&now)
+
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "brands", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "brands", "10.0.0.1").Code)
+	rec := limitedRequest(l, "brands", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "brands", "10.0.0.2").Code, "Other clients have their own limit")
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "count", "10.0.0.1").Code, "Routes without limits are not limited")
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "brands", "10.0.0.1").Code)
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(map[string]RateLimit{"reload": {PerClient: 2, Global: 3}}, 0)
+	l.now = fixedClock(&now)
+
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "reload", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "reload", "10.0.0.2").Code)
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "reload", "10.0.0.3").Code)
+	rec := limitedRequest(l, "reload", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "20", rec.Header().Get("Retry-After"))
+
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, http.StatusOK, limitedRequest(l, "reload", "10.0.0.1").Code, "The client's token is not used up by a globally limited request")
+}
+
+func TestConcurrentStreamsLimit(t *testing.T) {
+	l := NewRateLimiter(nil, 1)
+	streaming := make(chan struct{})
+	release := make(chan struct{})
+	stream := l.LimitStream("brands", func(w http.ResponseWriter, r *http.Request) {
+		close(streaming)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	first := httptest.NewRecorder()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		stream(first, newRequest("GET", "/transformers/brands"))
+	}()
+	<-streaming
+
+	rec := httptest.NewRecorder()
+	stream(rec, newRequest("GET", "/transformers/brands"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	rec = httptest.NewRecorder()
+	l.LimitStream("brands", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(rec, newRequest("GET", "/transformers/brands"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestIdleBucketsAreForgotten(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(map[string]RateLimit{"brands": {PerClient: 2, Global: 10}}, 0)
+	l.now = fixedClock(&now)
+
+	limitedRequest(l, "brands", "10.0.0.1")
+	limitedRequest(l, "brands", "10.0.0.2")
+	assert.Len(t, l.buckets["brands"], 3)
+
+	now = now.Add(30 * time.Second)
+	limitedRequest(l, "brands", "10.0.0.1")
+	now = now.Add(45 * time.Second)
+	limitedRequest(l, "brands", "10.0.0.3")
+	assert.Len(t, l.buckets["brands"], 3, "Only the client idle for a minute is forgotten")
+	assert.NotContains(t, l.buckets["brands"], "10.0.0.2")
+
+	now = now.Add(2 * time.Minute)
+	l.Lock()
+	l.pruneBuckets(now)
+	l.Unlock()
+	assert.Empty(t, l.buckets)
+}
+
+func TestForgedForwardedForIsNotRateLimitedSeparately(t *testing.T) {
+	l := NewRateLimiter(map[string]RateLimit{"brands": {PerClient: 1}}, 0)
+	limited := l.Limit("brands", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for i, forged := range []string{"192.168.0.1", "192.168.0.2"} {
+		req := newRequest("GET", "/transformers/brands")
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forged)
+		rec := httptest.NewRecorder()
+		TrustedProxies(nil).Middleware(limited).ServeHTTP(rec, req)
+		if i == 0 {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package brands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+// Policies for what a reload serves when the curated brands can't be fetched from Bertha
+const (
+	// FailOnBerthaError - fail the reload and serve nothing
+	FailOnBerthaError = "fail"
+	// ServeTmeOnlyOnBerthaError - serve the TME brands, all uncurated
+	ServeTmeOnlyOnBerthaError = "tme-only"
+	// ServePreviousCuratedOnBerthaError - overlay the curated brands of the last successful Bertha fetch, or serve the TME brands uncurated if there is none
+	ServePreviousCuratedOnBerthaError = "previous-curated"
+)
+
+const (
+	reloadInProgress = "in progress"
+	reloadSucceeded  = "succeeded"
+	reloadDegraded   = "degraded"
+	reloadFailed     = "failed"
+
+	berthaBucket = "bertha"
+	berthaKey    = "previous"
+)
+
+// ValidBerthaFailurePolicy - whether policy is one of the Bertha failure policies
+func ValidBerthaFailurePolicy(policy string) bool {
+	return policy == FailOnBerthaError || policy == ServeTmeOnlyOnBerthaError || policy == ServePreviousCuratedOnBerthaError
+}
+
+type reloadResult struct {
+	TransactionID       string         `json:"transactionId,omitempty"`
+	Trigger             string         `json:"trigger,omitempty"`
+	Caller              string         `json:"caller,omitempty"`
+	Job                 string         `json:"job"`
+	Status              string         `json:"status"`
+	BerthaFailurePolicy string         `json:"berthaFailurePolicy"`
+	Curated             bool           `json:"curated"`
+	Started             string         `json:"started"`
+	Finished            string         `json:"finished,omitempty"`
+	Counts              reloadCounts   `json:"counts"`
+	Warnings            []brandWarning `json:"warnings,omitempty"`
+	Errors              []string       `json:"errors,omitempty"`
+	started             time.Time
+}
+
+func (s *brandServiceImpl) getLastReload() reloadResult {
+	s.RLock()
+	defer s.RUnlock()
+	return s.lastReload
+}
+
+func (s *brandServiceImpl) startReloadResult(job string, trigger reloadTrigger) {
+	s.Lock()
+	defer s.Unlock()
+	started := time.Now().UTC()
+	// The dump is of the brands before the reload, so the full listing is streamed from the cache until it finishes.
+	s.dump = nil
+	s.lastReload = reloadResult{
+		TransactionID:       trigger.TransactionID,
+		Trigger:             trigger.Source,
+		Caller:              trigger.Caller,
+		Job:                 job,
+		Status:              reloadInProgress,
+		BerthaFailurePolicy: s.berthaFailurePolicy,
+		Started:             started.Format(time.RFC3339),
+		started:             started,
+	}
+}
+
+func (s *brandServiceImpl) setTmeBrandCount(count int) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastReload.Counts.TmeBrands = count
+}
+
+func (s *brandServiceImpl) finishReloadResult(status string, curated bool, errs ...error) {
+	if status != reloadFailed {
+		s.updateDataQuality()
+		s.updateBrandsDump()
+	}
+	s.Lock()
+	s.lastReload.Status = status
+	s.lastReload.Curated = curated
+	s.lastReload.Finished = time.Now().UTC().Format(time.RFC3339)
+	for _, err := range errs {
+		s.lastReload.Errors = append(s.lastReload.Errors, err.Error())
+	}
+	if status != reloadFailed {
+		s.lastReload.Counts.Brands = s.quality.Count
+		s.lastReload.Counts.UncuratedBrands = s.quality.Uncurated
+	}
+	reloadDuration.WithLabelValues(status).Observe(time.Since(s.lastReload.started).Seconds())
+	record := s.lastReload
+	s.Unlock()
+
+	s.auditReload(record)
+}
+
+// applyBerthaFailurePolicy - decide what to serve after the TME brands have loaded but Bertha couldn't be fetched
+func (s *brandServiceImpl) applyBerthaFailurePolicy(ctx context.Context, berthaErr error) error {
+	switch s.berthaFailurePolicy {
+	case ServePreviousCuratedOnBerthaError:
+		if bBrands, found := s.getPreviousBerthaBrands(); found {
+			if err := s.loadCuratedBrands(ctx, bBrands); err != nil {
+				log.Errorf("Error while loading in the previous curated brands: [%v]", err.Error())
+				s.setDataLoaded(false)
+				s.finishReloadResult(reloadFailed, false, berthaErr, err)
+				return err
+			}
+			log.Warnf("Serving the previous curated brands as Bertha failed: [%v]", berthaErr.Error())
+			s.finishReloadResult(reloadDegraded, true, berthaErr, fmt.Errorf("Serving the previous curated brands"))
+			return nil
+		}
+		log.Warnf("No previous curated brands, serving uncurated TME brands as Bertha failed: [%v]", berthaErr.Error())
+		s.finishReloadResult(reloadDegraded, false, berthaErr, fmt.Errorf("No previous curated brands, serving uncurated TME brands"))
+		return nil
+	case ServeTmeOnlyOnBerthaError:
+		log.Warnf("Serving uncurated TME brands as Bertha failed: [%v]", berthaErr.Error())
+		s.finishReloadResult(reloadDegraded, false, berthaErr, fmt.Errorf("Serving uncurated TME brands"))
+		return nil
+	default:
+		s.setDataLoaded(false)
+		s.finishReloadResult(reloadFailed, false, berthaErr)
+		return berthaErr
+	}
+}
+
+func (s *brandServiceImpl) getPreviousBerthaBrands() ([]berthaBrand, bool) {
+	var bBrands []berthaBrand
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(berthaBucket))
+		if bucket == nil {
+			return fmt.Errorf("Bucket %v not found!", berthaBucket)
+		}
+		value := bucket.Get([]byte(berthaKey))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &bBrands)
+	})
+	if err != nil {
+		log.Warnf("Cannot read the previous curated brands: %v", err.Error())
+		return nil, false
+	}
+	return bBrands, found
+}
+
+func (s *brandServiceImpl) putPreviousBerthaBrands(bBrands []berthaBrand) error {
+	value, err := json.Marshal(bBrands)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(berthaBucket))
+		if bucket == nil {
+			return fmt.Errorf("Cache bucket [%v] not found!", berthaBucket)
+		}
+		return bucket.Put([]byte(berthaKey), value)
+	})
+}
@@ -0,0 +1,106 @@
+package brands
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailedReloadNoBerthaRecordsResult(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&mockClient{err: errors.New("bertha fail")}))
+	defer service.Shutdown()
+
+	result := waitTillReloadFinished(t, service)
+	assert.Equal(t, reloadFailed, result.Status)
+	assert.Equal(t, FailOnBerthaError, result.BerthaFailurePolicy)
+	assert.Equal(t, []string{"bertha fail"}, result.Errors)
+	assert.False(t, service.isDataLoaded())
+}
+
+func TestReloadServesTmeOnlyBrandsWhenBerthaFails(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.BerthaFailurePolicy = ServeTmeOnlyOnBerthaError }, withHTTPClient(&mockClient{err: errors.New("bertha fail")}))
+	defer service.Shutdown()
+
+	result := waitTillReloadFinished(t, service)
+	assert.Equal(t, reloadDegraded, result.Status)
+	assert.Equal(t, ServeTmeOnlyOnBerthaError, result.BerthaFailurePolicy)
+	assert.False(t, result.Curated)
+	assert.True(t, service.isDataLoaded())
+	assertCount(t, service, 2)
+
+	actualBrand, found, err := service.getBrandByUUID(context.Background(), bobUuid)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, actualBrand.Uncurated)
+
+	_, found = service.getLastFetch(tmeDependency)
+	assert.True(t, found)
+	_, found = service.getLastFetch(berthaDependency)
+	assert.False(t, found)
+}
+
+func TestReloadKeepsPreviousCuratedBrandsWhenBerthaFails(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "FT Data", RawID: "0f6e4716-b2b5-485a-9da9-76e777a719f2"}}}
+	client := mockClient{resp: []berthaBrand{testBerthaBrandFixedUUID}}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.BerthaFailurePolicy = ServePreviousCuratedOnBerthaError }, withHTTPClient(&client))
+	defer service.Shutdown()
+
+	result := waitTillReloadFinished(t, service)
+	assert.Equal(t, reloadSucceeded, result.Status)
+	assert.True(t, result.Curated)
+
+	client.err = errors.New("bertha fail")
+	repo.count = 0
+	assert.NoError(t, service.reloadDB(context.Background(), reloadTrigger{}))
+
+	result = service.getLastReload()
+	assert.Equal(t, reloadDegraded, result.Status)
+	assert.True(t, result.Curated)
+	assert.Contains(t, result.Errors, "bertha fail")
+	actualBrand, found, err := service.getBrandByUUID(context.Background(), expectedBrandFixedUUID.UUID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.EqualValues(t, expectedBrandFixedUUID, actualBrand)
+}
+
+func TestReloadWithoutPreviousCuratedBrandsServesTmeOnly(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.BerthaFailurePolicy = ServePreviousCuratedOnBerthaError }, withHTTPClient(&mockClient{err: errors.New("bertha fail")}))
+	defer service.Shutdown()
+
+	result := waitTillReloadFinished(t, service)
+	assert.Equal(t, reloadDegraded, result.Status)
+	assert.False(t, result.Curated)
+	assert.True(t, service.isDataLoaded())
+	assertCount(t, service, 1)
+}
+
+// waitTillReloadFinished - wait for the running reload to finish and release the cache to the next one
+func waitTillReloadFinished(t *testing.T, s BrandService) reloadResult {
+	for i := 1; i <= 100; i++ {
+		if impl, ok := s.(*brandServiceImpl); ok && impl.isReloading() {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if result := s.getLastReload(); result.Finished != "" {
+			return result
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Fail(t, "Reload did not finish")
+	return s.getLastReload()
+}
@@ -0,0 +1,80 @@
+package brands
+
+import (
+	"net/http"
+
+	"github.com/Financial-Times/go-fthealth/v1a"
+	"github.com/Financial-Times/http-handlers-go/httphandlers"
+	"github.com/Financial-Times/service-status-go/gtg"
+	status "github.com/Financial-Times/service-status-go/httphandlers"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rcrowley/go-metrics"
+)
+
+// NewRouter - the router of every endpoint the service serves. The transformer's endpoints are rate limited by the
+// limiter, the admin ones protected by auth, telling clients apart by the X-Forwarded-For entries of the trusted proxies,
+// and they are logged, counted and traced along with requests to unknown paths. The monitoring endpoints, with the health checks, are served as they are.
+// Every route must be described in the API document: TestAPIDocumentDescribesEveryRoute walks this router.
+func NewRouter(handler BrandHandler, auth *Authenticator, limiter *RateLimiter, proxies TrustedProxies, healthChecks []v1a.Check) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc(status.PingPath, status.PingHandler)
+	router.HandleFunc(status.PingPathDW, status.PingHandler)
+	router.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
+	router.HandleFunc(status.BuildInfoPathDW, status.BuildInfoHandler)
+	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/__api", handler.GetAPIDocument)
+	router.HandleFunc("/__schema/brand", handler.GetBrandSchema)
+	router.HandleFunc("/__health", v1a.Handler("V1 Brands Transformer Healthchecks", "Checks for the health of the service", healthChecks...))
+	router.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(gtg.StatusChecker(handler.G2GCheck)))
+	router.NotFoundHandler = monitored(http.HandlerFunc(handler.NotFound))
+
+	servicesRouter := router.NewRoute().Subrouter()
+	servicesRouter.Use(proxies.Middleware, monitored, TracingMiddleware, CompressionMiddleware)
+
+	getBrandsSubrouter := servicesRouter.Path("/transformers/brands").Subrouter()
+	getBrandsSubrouter.Methods("GET").HandlerFunc(limiter.LimitStream("brands", handler.GetBrands))
+	getBrandsSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	brandCountSubrouter := servicesRouter.Path("/transformers/brands/__count").Subrouter()
+	brandCountSubrouter.Methods("GET").HandlerFunc(limiter.Limit("count", handler.GetCount))
+	brandCountSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	brandIDsSubrouter := servicesRouter.Path("/transformers/brands/__ids").Subrouter()
+	brandIDsSubrouter.Methods("GET").HandlerFunc(limiter.LimitStream("ids", handler.GetBrandUUIDs))
+	brandIDsSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	concordancesSubrouter := servicesRouter.Path("/transformers/brands/__concordances").Subrouter()
+	concordancesSubrouter.Methods("GET").HandlerFunc(limiter.LimitStream("concordances", handler.GetConcordances))
+	concordancesSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	uuidOverridesSubrouter := servicesRouter.Path("/transformers/brands/__uuid-overrides").Subrouter()
+	uuidOverridesSubrouter.Methods("GET").HandlerFunc(limiter.Limit("uuid-overrides", handler.GetUUIDOverrides))
+	uuidOverridesSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	brandByUUIDSubrouter := servicesRouter.Path("/transformers/brands/{uuid:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}}").Subrouter()
+	brandByUUIDSubrouter.Methods("GET").HandlerFunc(limiter.Limit("brand", handler.GetBrandByUUID))
+	brandByUUIDSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	auditSubrouter := servicesRouter.Path("/transformers/brands/__audit").Subrouter()
+	auditSubrouter.Methods("GET").HandlerFunc(limiter.Limit("audit", handler.RequireRole(auth, AdminRole, handler.GetAuditRecords)))
+	auditSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	quarantineSubrouter := servicesRouter.Path("/transformers/brands/__quarantine").Subrouter()
+	quarantineSubrouter.Methods("GET").HandlerFunc(limiter.Limit("quarantine", handler.GetQuarantinedBrands))
+	quarantineSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
+
+	reloadSubrouter := servicesRouter.Path("/transformers/brands/__reload").Subrouter()
+	reloadSubrouter.Methods("GET").HandlerFunc(limiter.Limit("reload-status", handler.GetLastReload))
+	reloadSubrouter.Methods("POST").HandlerFunc(limiter.Limit("reload", handler.RequireRole(auth, AdminRole, handler.Reload)))
+	reloadSubrouter.Methods("DELETE").HandlerFunc(limiter.Limit("reload", handler.RequireRole(auth, AdminRole, handler.CancelReload)))
+	reloadSubrouter.NewRoute().HandlerFunc(handler.OnlyGetPostAndDeleteAllowed)
+
+	return router
+}
+
+// monitored - log the request with its transaction ID and count it in the metrics registry
+func monitored(next http.Handler) http.Handler {
+	return httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, httphandlers.TransactionAwareRequestLoggingHandler(log.StandardLogger(), next))
+}
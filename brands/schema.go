@@ -0,0 +1,284 @@
+package brands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+// brandSchema - the JSON Schema of the brands the service outputs, served at /__schema/brand
+const brandSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "/__schema/brand",
+  "title": "Brand",
+  "description": "A V1 brand from TME, curated with the information in Bertha",
+  "type": "object",
+  "required": ["uuid", "prefLabel"],
+  "additionalProperties": false,
+  "properties": {
+    "uuid": {"type": "string", "pattern": "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"},
+    "parentUUID": {"type": "string", "pattern": "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"},
+    "prefLabel": {"type": "string", "minLength": 1},
+    "type": {"type": "string"},
+    "taxonomy": {"type": "string", "description": "The TME taxonomy the brand came from"},
+    "alternativeIdentifiers": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "TME": {"type": "array", "items": {"type": "string", "minLength": 1}},
+        "uuids": {"type": "array", "items": {"type": "string", "pattern": "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"}}
+      }
+    },
+    "aliases": {"type": "array", "items": {"type": "string"}},
+    "strapline": {"type": "string"},
+    "description": {"type": "string"},
+    "descriptionXML": {"type": "string"},
+    "_imageUrl": {"type": "string", "pattern": "^(https?:)?//"},
+    "broaderUUIDs": {"type": "array", "items": {"type": "string", "pattern": "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"}},
+    "isDeprecated": {"type": "boolean"},
+    "createdDate": {"type": "string"},
+    "lastModifiedDate": {"type": "string"},
+    "uncurated": {"type": "boolean", "description": "The brand has no curated information from Bertha"}
+  }
+}
+`
+
+// Modes for validating brands against the schema before they are written to the cache
+const (
+	// NoBrandValidation - write every brand, valid or not
+	NoBrandValidation = "off"
+	// RejectInvalidBrands - don't write brands that violate the schema
+	RejectInvalidBrands = "reject"
+	// QuarantineInvalidBrands - keep brands that violate the schema in the quarantine instead of the cache
+	QuarantineInvalidBrands = "quarantine"
+
+	quarantineBucket = "quarantine"
+)
+
+// ValidBrandValidation - whether mode is one of the brand validation modes
+func ValidBrandValidation(mode string) bool {
+	return mode == NoBrandValidation || mode == RejectInvalidBrands || mode == QuarantineInvalidBrands
+}
+
+// jsonSchema - the part of JSON Schema the brand schema uses
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Items                *jsonSchema            `json:"items"`
+	Pattern              string                 `json:"pattern"`
+	MinLength            int                    `json:"minLength"`
+	pattern              *regexp.Regexp
+}
+
+var compiledBrandSchema = mustCompileSchema(brandSchema)
+
+func mustCompileSchema(schema string) *jsonSchema {
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		panic(err)
+	}
+	s.compile()
+	return &s
+}
+
+func (s *jsonSchema) compile() {
+	if s.Pattern != "" {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+	for _, property := range s.Properties {
+		property.compile()
+	}
+	if s.Items != nil {
+		s.Items.compile()
+	}
+}
+
+// validate - the ways value, decoded from JSON, violates the schema
+func (s *jsonSchema) validate(path string, value interface{}) []string {
+	var violations []string
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is not an object", path)}
+		}
+		for _, name := range s.Required {
+			if _, found := object[name]; !found {
+				violations = append(violations, fmt.Sprintf("%s.%s is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, found := s.Properties[name]; found {
+				violations = append(violations, property.validate(path+"."+name, object[name])...)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				violations = append(violations, fmt.Sprintf("%s.%s is not allowed", path, name))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is not an array", path)}
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				violations = append(violations, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s is not a string", path)}
+		}
+		if len(str) < s.MinLength {
+			violations = append(violations, fmt.Sprintf("%s is shorter than %d", path, s.MinLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			violations = append(violations, fmt.Sprintf("%s does not match %s", path, s.Pattern))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s is not a boolean", path)}
+		}
+	}
+	return violations
+}
+
+// validateBrand - the ways the brand, as it is served, violates the brand schema
+func validateBrand(b brand) []string {
+	marshalled, err := json.Marshal(b)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var value interface{}
+	if err := json.Unmarshal(marshalled, &value); err != nil {
+		return []string{err.Error()}
+	}
+	return compiledBrandSchema.validate("$", value)
+}
+
+type quarantinedBrand struct {
+	Brand      brand    `json:"brand"`
+	Violations []string `json:"violations"`
+}
+
+func (s *brandServiceImpl) validatesBrands() bool {
+	return s.brandValidation != "" && s.brandValidation != NoBrandValidation
+}
+
+// brandViolations - the ways the brand violates the brand schema, or none when brands aren't validated
+func (s *brandServiceImpl) brandViolations(b brand) []string {
+	if !s.validatesBrands() {
+		return nil
+	}
+	return validateBrand(b)
+}
+
+// screenBrands - split the brands into those to write and those that violate the brand schema
+func (s *brandServiceImpl) screenBrands(brands []brand) ([]brand, []quarantinedBrand) {
+	if !s.validatesBrands() {
+		return brands, nil
+	}
+	valid := make([]brand, 0, len(brands))
+	var invalid []quarantinedBrand
+	for _, b := range brands {
+		if violations := validateBrand(b); len(violations) > 0 {
+			invalid = append(invalid, quarantinedBrand{Brand: b, Violations: violations})
+			continue
+		}
+		valid = append(valid, b)
+	}
+	return valid, invalid
+}
+
+// quarantineBrand - keep the invalid brand with its violations, when quarantining
+func (s *brandServiceImpl) quarantineBrand(tx *bolt.Tx, invalid quarantinedBrand) error {
+	if s.brandValidation != QuarantineInvalidBrands {
+		return nil
+	}
+	bucket := tx.Bucket([]byte(quarantineBucket))
+	if bucket == nil {
+		return fmt.Errorf("Cache bucket [%v] not found!", quarantineBucket)
+	}
+	value, err := json.Marshal(invalid)
+	if err != nil {
+		return err
+	}
+	key := invalid.Brand.UUID
+	if key == "" {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key = fmt.Sprintf("no-uuid-%d", seq)
+	}
+	return bucket.Put([]byte(key), value)
+}
+
+func (s *brandServiceImpl) invalidBrandWarning(invalid quarantinedBrand) brandWarning {
+	action := "rejected"
+	if s.brandValidation == QuarantineInvalidBrands {
+		action = "quarantined"
+	}
+	log.Warnf("Brand %s [%s] is invalid and %s: %v", invalid.Brand.PrefLabel, invalid.Brand.UUID, action, strings.Join(invalid.Violations, "; "))
+	w := brandWarning{UUID: invalid.Brand.UUID, PrefLabel: invalid.Brand.PrefLabel, Message: fmt.Sprintf("Invalid brand %s: %s", action, strings.Join(invalid.Violations, "; "))}
+	if len(invalid.Brand.AlternativeIdentifiers.TME) > 0 {
+		w.TmeIdentifier = invalid.Brand.AlternativeIdentifiers.TME[0]
+	}
+	return w
+}
+
+// recordInvalidBrands - count and warn of the TME brands of a written batch that violated the brand schema
+func (s *brandServiceImpl) recordInvalidBrands(invalid []quarantinedBrand) {
+	if len(invalid) == 0 {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.lastReload.Counts.InvalidBrands += len(invalid)
+	for _, q := range invalid {
+		s.lastReload.Warnings = append(s.lastReload.Warnings, s.invalidBrandWarning(q))
+	}
+}
+
+// getQuarantinedBrands - the brands of the last reloads that violated the brand schema, with their violations
+func (s *brandServiceImpl) getQuarantinedBrands(ctx context.Context) ([]quarantinedBrand, error) {
+	s.RLock()
+	defer s.RUnlock()
+	quarantined := []quarantinedBrand{}
+	if s.db == nil {
+		return quarantined, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_, span := startSpan(ctx, "cache.read", cacheQueryAttribute.String("quarantine"))
+	defer span.End()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(quarantineBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var q quarantinedBrand
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+			quarantined = append(quarantined, q)
+			return nil
+		})
+	})
+	return quarantined, err
+}
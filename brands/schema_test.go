@@ -0,0 +1,95 @@
+package brands
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrandSchemaIsServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	router(&dummyService{}).ServeHTTP(rec, newRequest("GET", "/__schema/brand"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/schema+json", rec.Header().Get("Content-Type"))
+
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &schema))
+	for _, name := range brandFields {
+		assert.Contains(t, schema.Properties, name, "%s is not in the brand schema", name)
+	}
+	assert.Len(t, schema.Properties, len(brandFields))
+}
+
+func TestValidateBrand(t *testing.T) {
+	valid := brand{UUID: bobUuid, ParentUUID: financialTimesBrandUuid, PrefLabel: "Bob", AlternativeIdentifiers: alternativeIdentifiers{TME: []string{"Ym9i-QnJhbmRz"}, UUIDs: []string{bobUuid}}, ImageURL: "http://bob.com/bob.png", BroaderUUIDs: []string{financialTimesBrandUuid}}
+	tests := []struct {
+		name       string
+		update     func(b *brand)
+		violations []string
+	}{
+		{"Valid", func(b *brand) {}, nil},
+		{"No prefLabel", func(b *brand) { b.PrefLabel = "" }, []string{"$.prefLabel is required"}},
+		{"Invalid uuid", func(b *brand) { b.UUID = "bob" }, []string{"$.uuid does not match " + compiledBrandSchema.Properties["uuid"].Pattern}},
+		{"Invalid alternative uuid", func(b *brand) { b.AlternativeIdentifiers.UUIDs = []string{"bob"} }, []string{"$.alternativeIdentifiers.uuids[0] does not match " + compiledBrandSchema.Properties["uuid"].Pattern}},
+		{"Empty TME identifier", func(b *brand) { b.AlternativeIdentifiers.TME = []string{""} }, []string{"$.alternativeIdentifiers.TME[0] is shorter than 1"}},
+		{"Relative image url", func(b *brand) { b.ImageURL = "bob.png" }, []string{"$._imageUrl does not match " + compiledBrandSchema.Properties["_imageUrl"].Pattern}},
+		{"Protocol relative image url", func(b *brand) { b.ImageURL = "//bob.com/bob.png" }, nil},
+	}
+	for _, test := range tests {
+		b := valid
+		b.AlternativeIdentifiers = alternativeIdentifiers{TME: valid.AlternativeIdentifiers.TME, UUIDs: valid.AlternativeIdentifiers.UUIDs}
+		test.update(&b)
+		assert.Equal(t, test.violations, validateBrand(b), test.name)
+	}
+}
+
+func TestInvalidBrandsAreQuarantined(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "", RawID: "nameless"}}}
+	curated := berthaBrand{PrefLabel: "Bob", ImageURL: "bob.png", TmeIdentifier: buildTmeIdentifier("bob", "Brands")}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.BrandValidation = QuarantineInvalidBrands }, withHTTPClient(&mockClient{resp: []berthaBrand{curated}}))
+	defer service.Shutdown()
+
+	result := waitTillReloadFinished(t, service)
+	assert.Equal(t, reloadSucceeded, result.Status)
+	assert.Equal(t, 2, result.Counts.InvalidBrands)
+	assert.Len(t, result.Warnings, 2)
+	assertCount(t, service, 1)
+
+	bob, found, err := service.getBrandByUUID(context.Background(), bobUuid)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, bob.Uncurated, "The invalid curated brand should leave the TME brand as it was")
+
+	quarantined, err := service.getQuarantinedBrands(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, quarantined, 2) {
+		for _, q := range quarantined {
+			assert.NotEmpty(t, q.Violations)
+		}
+	}
+}
+
+func TestInvalidBrandsAreRejected(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "", RawID: "nameless"}}}
+	service := createTestBrandService(&repo, tmpfile.Name(), func(c *ServiceConfig) { c.BrandValidation = RejectInvalidBrands })
+	defer service.Shutdown()
+
+	result := waitTillReloadFinished(t, service)
+	assert.Equal(t, 1, result.Counts.InvalidBrands)
+	assertCount(t, service, 1)
+
+	quarantined, err := service.getQuarantinedBrands(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, quarantined)
+}
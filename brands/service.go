@@ -1,6 +1,7 @@
 package brands
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/jaytaylor/html2text"
 	"github.com/pborman/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type httpClient interface {
@@ -22,49 +24,132 @@ type httpClient interface {
 
 const (
 	cacheBucket             = "brand"
+	concordanceBucket       = "concordance"
 	financialTimesBrandUuid = "dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"
+
+	// cacheMmapSize - the address space the cache is mapped with up front. bolt can only grow the mapping once no read
+	// transaction is open, so without room to grow a reload would wait on every listing being streamed.
+	cacheMmapSize = 256 << 20
 )
 
 // BrandService - interface for retrieving v1 brands
 type BrandService interface {
-	getBrands() (io.PipeReader, error)
-	getBrandLinks() (io.PipeReader, error)
-	getBrandUUIDs() (io.PipeReader, error)
-	getBrandByUUID(uuid string) (brand, bool, error)
-	getCount() (int, error)
+	getBrands(ctx context.Context, filter brandFilter, fields fieldProjection) (*io.PipeReader, error)
+	getBrandLinks(ctx context.Context) (*io.PipeReader, error)
+	getBrandUUIDs(ctx context.Context, filter brandFilter) (*io.PipeReader, error)
+	getBrandByUUID(ctx context.Context, uuid string) (brand, bool, error)
+	getCanonicalUUID(ctx context.Context, uuid string) (string, bool, error)
+	getConcordances(ctx context.Context) (*io.PipeReader, error)
+	getCount(ctx context.Context) (int, error)
+	getUUIDOverrides() map[string]string
 	isInitialised() bool
 	isDataLoaded() bool
-	reloadDB() error
+	reloadDB(ctx context.Context, trigger reloadTrigger) error
+	replayDB(ctx context.Context, archiveID string, trigger reloadTrigger) error
+	startReloadDB(trigger reloadTrigger) error
+	startReplayDB(archiveID string, trigger reloadTrigger) error
+	cancelReload() bool
+	canReplay(archiveID string) error
+	getLastReload() reloadResult
+	getLastFetch(dependency string) (time.Time, bool)
+	getDataQuality() dataQuality
+	getAuditRecords(ctx context.Context, limit int) ([]json.RawMessage, error)
+	getBrandsDump(encoding string) (io.ReadSeeker, string, time.Time, bool)
+	getQuarantinedBrands(ctx context.Context) ([]quarantinedBrand, error)
+	auditAccessDenied(record accessDenied)
+	StopReloads()
+	isStopping() bool
 	Shutdown() error
-	loadCuratedBrands([]berthaBrand) error
+	loadCuratedBrands(ctx context.Context, bBrands []berthaBrand) error
+}
+
+// TmeTaxonomy - a TME taxonomy and the repository its terms are read from
+type TmeTaxonomy struct {
+	Name       string
+	Repository tmereader.Repository
 }
 
 type brandServiceImpl struct {
 	sync.RWMutex
-	repository    tmereader.Repository
-	baseURL       string
-	taxonomyName  string
-	maxTmeRecords int
-	initialised   bool
-	dataLoaded    bool
-	cacheFileName string
-	db            *bolt.DB
-	berthaURL     string
-	httpClient    httpClient
+	taxonomies          []TmeTaxonomy
+	baseURL             string
+	maxTmeRecords       int
+	initialised         bool
+	dataLoaded          bool
+	cacheFileName       string
+	db                  *bolt.DB
+	berthaURL           string
+	berthaCSVColumns    map[string]string
+	httpClient          httpClient
+	uuidOverridesSource string
+	uuidOverrides       map[string]string
+	archive             *PayloadArchive
+	pageRetryPolicy     RetryPolicy
+	berthaFailurePolicy string
+	brandValidation     string
+	lastReload          reloadResult
+	lastFetches         map[string]time.Time
+	quality             dataQuality
+	stopping            bool
+	reloads             sync.WaitGroup
+	reloading           bool
+	streams             sync.WaitGroup
+	closing             bool
+	cancelRunningReload context.CancelFunc
+	dump                *brandsDump
+}
+
+var (
+	errServiceStopping  = errors.New("Service is shutting down")
+	errReloadStopped    = errors.New("Reload stopped by shutdown, it resumes from the last written page of TME terms on the next reload")
+	errReloadCancelled  = errors.New("Reload cancelled, it resumes from the last written page of TME terms on the next reload")
+	errReloadInProgress = errors.New("A reload is already in progress")
+)
+
+// ServiceConfig - where a BrandService reads the brands from, and how it loads them.
+// The policies left empty take their defaults: fail the reload on a Bertha error, and no brand validation.
+type ServiceConfig struct {
+	Taxonomies          []TmeTaxonomy
+	BaseURL             string
+	MaxTmeRecords       int
+	CacheFileName       string
+	BerthaURL           string
+	BerthaCSVColumns    map[string]string
+	UUIDOverridesSource string
+	Archive             *PayloadArchive
+	PageRetryPolicy     RetryPolicy
+	BerthaFailurePolicy string
+	BrandValidation     string
+	HTTPClient          httpClient
 }
 
 // NewBrandService - create a new BrandService
-func NewBrandService(repo tmereader.Repository,
-	baseURL string,
-	taxonomyName string,
-	maxTmeRecords int,
-	cacheFileName string,
-	berthaURL string,
-	httpClient httpClient) BrandService {
-	s := &brandServiceImpl{repository: repo, baseURL: baseURL, taxonomyName: taxonomyName, maxTmeRecords: maxTmeRecords, initialised: true, cacheFileName: cacheFileName, berthaURL: berthaURL, httpClient: httpClient}
+func NewBrandService(config ServiceConfig) BrandService {
+	if config.BerthaFailurePolicy == "" {
+		config.BerthaFailurePolicy = FailOnBerthaError
+	}
+	if config.BrandValidation == "" {
+		config.BrandValidation = NoBrandValidation
+	}
+	s := &brandServiceImpl{
+		taxonomies:          config.Taxonomies,
+		baseURL:             config.BaseURL,
+		maxTmeRecords:       config.MaxTmeRecords,
+		initialised:         true,
+		cacheFileName:       config.CacheFileName,
+		berthaURL:           config.BerthaURL,
+		berthaCSVColumns:    config.BerthaCSVColumns,
+		uuidOverridesSource: config.UUIDOverridesSource,
+		uuidOverrides:       berthaUUIDmap(),
+		archive:             config.Archive,
+		pageRetryPolicy:     config.PageRetryPolicy,
+		berthaFailurePolicy: config.BerthaFailurePolicy,
+		brandValidation:     config.BrandValidation,
+		httpClient:          config.HTTPClient,
+	}
 	s.setDataLoaded(false)
 	go func(service *brandServiceImpl) {
-		err := service.reloadDB()
+		err := service.reloadDB(context.Background(), newStartupTrigger())
 		if err != nil {
 			log.Errorf("Cannot reload DB. Error was: %s", err.Error())
 			service.setDataLoaded(false)
@@ -97,24 +182,95 @@ func (s *brandServiceImpl) setDataLoaded(val bool) {
 	s.Unlock()
 }
 
+func (s *brandServiceImpl) getUUIDOverrides() map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.uuidOverrides
+}
+
+func (s *brandServiceImpl) setUUIDOverrides(overrides map[string]string) {
+	s.Lock()
+	s.uuidOverrides = overrides
+	s.Unlock()
+}
+
+// StopReloads - refuse new reloads and cancel a running one. The service is no longer good to go.
+func (s *brandServiceImpl) StopReloads() {
+	s.Lock()
+	defer s.Unlock()
+	s.stopping = true
+	if s.cancelRunningReload != nil {
+		s.cancelRunningReload()
+	}
+}
+
+// cancelReload - cancel the running reload, if there is one
+func (s *brandServiceImpl) cancelReload() bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.cancelRunningReload == nil {
+		return false
+	}
+	s.cancelRunningReload()
+	return true
+}
+
+// reloadCancelled - why a reload's context was done: the service shutting down, a cancel request or the caller's deadline
+func (s *brandServiceImpl) reloadCancelled(err error) error {
+	if s.isStopping() {
+		return errReloadStopped
+	}
+	if err == context.Canceled {
+		return errReloadCancelled
+	}
+	return err
+}
+
+func (s *brandServiceImpl) isReloading() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.reloading
+}
+
+func (s *brandServiceImpl) isStopping() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.stopping
+}
+
+// Shutdown - stop reloads, wait for a running one to finish writing and close the cache
 func (s *brandServiceImpl) Shutdown() error {
 	log.Info("Shuting down...")
+	s.StopReloads()
+	s.reloads.Wait()
 	s.Lock()
-	defer s.Unlock()
 	s.initialised = false
 	s.dataLoaded = false
+	s.closing = true
+	s.Unlock()
+
+	// bolt doesn't wait for read transactions when it closes. No stream starts once closing is set, and the
+	// lock isn't held while waiting so a slow client doesn't hold up everything else that takes it
+	s.streams.Wait()
+	s.Lock()
+	defer s.Unlock()
 	if s.db == nil {
 		return errors.New("DB not open")
 	}
 	return s.db.Close()
 }
 
-func (s *brandServiceImpl) getCount() (int, error) {
+func (s *brandServiceImpl) getCount(ctx context.Context) (int, error) {
 	s.RLock()
 	defer s.RUnlock()
 	if !s.isDataLoaded() {
 		return 0, nil
 	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	_, span := startSpan(ctx, "cache.read", cacheQueryAttribute.String("count"))
+	defer span.End()
 
 	var count int
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -128,87 +284,139 @@ func (s *brandServiceImpl) getCount() (int, error) {
 	return count, err
 }
 
-func (s *brandServiceImpl) getBrands() (io.PipeReader, error) {
-	s.RLock()
+// countBrands - the number of brands in the cache, whether or not loading has finished
+func (s *brandServiceImpl) countBrands() int {
+	var count int
+	s.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(cacheBucket)); bucket != nil {
+			count = bucket.Stats().KeyN
+		}
+		return nil
+	})
+	return count
+}
+
+// streamCache - stream what write produces from a read transaction of the cache through a pipe.
+// The service is only locked while the transaction is opened: bolt keeps what it reads consistent while a reload
+// writes, so a slow client doesn't hold up the reload or anything else waiting on the lock.
+// The pipe is closed when ctx is done, so a client that has gone away doesn't keep the transaction open.
+func (s *brandServiceImpl) streamCache(ctx context.Context, query string, write func(tx *bolt.Tx, w io.Writer) error) (*io.PipeReader, error) {
+	ctx, span := startSpan(ctx, "cache.read", cacheQueryAttribute.String(query))
 	pv, pw := io.Pipe()
+	s.RLock()
+	tx, err := s.beginStream()
+	s.RUnlock()
+	if err != nil {
+		endSpan(span, err)
+		pw.CloseWithError(err)
+		return pv, nil
+	}
+	finished := make(chan struct{})
 	go func() {
-		defer s.RUnlock()
-		defer pw.Close()
-		s.db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(cacheBucket))
-			c := b.Cursor()
-			for k, v := c.First(); k != nil; k, v = c.Next() {
-				if _, err := pw.Write(v); err != nil {
-					return err
-				}
-				io.WriteString(pw, "\n")
-			}
-			return nil
-		})
+		select {
+		case <-ctx.Done():
+			pv.CloseWithError(ctx.Err())
+		case <-finished:
+		}
 	}()
-	return *pv, nil
+	go func() {
+		defer s.streams.Done()
+		defer close(finished)
+		defer tx.Rollback()
+		err := write(tx, pw)
+		endSpan(span, err)
+		pw.CloseWithError(err)
+	}()
+	return pv, nil
 }
 
-func (s *brandServiceImpl) getBrandUUIDs() (io.PipeReader, error) {
-	s.RLock()
-	pv, pw := io.Pipe()
-	go func() {
-		defer s.RUnlock()
-		defer pw.Close()
-		s.db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(cacheBucket))
-			c := b.Cursor()
-			encoder := json.NewEncoder(pw)
-			for k, _ := c.First(); k != nil; k, _ = c.Next() {
-				if k == nil {
-					break
-				}
-				pl := brandUUID{UUID: string(k[:])}
-				if err := encoder.Encode(pl); err != nil {
-					return err
-				}
+// beginStream - open a read transaction for a stream, counted so Shutdown can wait for it. Must hold the read lock.
+func (s *brandServiceImpl) beginStream() (*bolt.Tx, error) {
+	if s.closing || s.db == nil {
+		return nil, errServiceStopping
+	}
+	tx, err := s.db.Begin(false)
+	if err == nil {
+		s.streams.Add(1)
+	}
+	return tx, err
+}
+
+func (s *brandServiceImpl) getBrands(ctx context.Context, filter brandFilter, fields fieldProjection) (*io.PipeReader, error) {
+	return s.streamCache(ctx, "brands", func(tx *bolt.Tx, w io.Writer) error {
+		return writeBrands(tx, w, filter, fields)
+	})
+}
+
+// writeBrands - write the cached brands matching the filter, limited to the fields, one per line
+func writeBrands(tx *bolt.Tx, w io.Writer, filter brandFilter, fields fieldProjection) error {
+	b := tx.Bucket([]byte(cacheBucket))
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		matched, err := filter.matchesCached(v)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		projected, err := fields.project(v)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(projected); err != nil {
+			return err
+		}
+		io.WriteString(w, "\n")
+	}
+	return nil
+}
+
+func (s *brandServiceImpl) getBrandUUIDs(ctx context.Context, filter brandFilter) (*io.PipeReader, error) {
+	return s.streamCache(ctx, "ids", func(tx *bolt.Tx, w io.Writer) error {
+		b := tx.Bucket([]byte(cacheBucket))
+		c := b.Cursor()
+		encoder := json.NewEncoder(w)
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			matched, err := filter.matchesCached(v)
+			if err != nil {
+				return err
 			}
-			return nil
-		})
-	}()
-	return *pv, nil
+			if !matched {
+				continue
+			}
+			pl := brandUUID{UUID: string(k[:])}
+			if err := encoder.Encode(pl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (s *brandServiceImpl) getBrandLinks() (io.PipeReader, error) {
-	s.RLock()
-	pv, pw := io.Pipe()
-	go func() {
-		defer s.RUnlock()
-		defer pw.Close()
-		io.WriteString(pw, "[")
-		s.db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(cacheBucket))
-			c := b.Cursor()
-			encoder := json.NewEncoder(pw)
-			var k []byte
-			k, _ = c.First()
-			for {
-				if k == nil {
-					break
-				}
-				pl := brandLink{APIURL: s.baseURL + "/" + string(k[:])}
-				if err := encoder.Encode(pl); err != nil {
-					return err
-				}
-				if k, _ = c.Next(); k != nil {
-					io.WriteString(pw, ",")
-				}
+func (s *brandServiceImpl) getBrandLinks(ctx context.Context) (*io.PipeReader, error) {
+	return s.streamCache(ctx, "links", func(tx *bolt.Tx, w io.Writer) error {
+		b := tx.Bucket([]byte(cacheBucket))
+		c := b.Cursor()
+		encoder := json.NewEncoder(w)
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			pl := brandLink{APIURL: s.baseURL + "/" + string(k[:])}
+			if err := encoder.Encode(pl); err != nil {
+				return err
 			}
-			return nil
-		})
-		io.WriteString(pw, "]")
-	}()
-	return *pv, nil
+		}
+		return nil
+	})
 }
 
-func (s *brandServiceImpl) getBrandByUUID(uuid string) (brand, bool, error) {
+func (s *brandServiceImpl) getBrandByUUID(ctx context.Context, uuid string) (brand, bool, error) {
 	s.RLock()
 	defer s.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return brand{}, false, err
+	}
+	_, span := startSpan(ctx, "cache.read", cacheQueryAttribute.String("brand"))
+	defer span.End()
 	var cachedValue []byte
 	err := s.db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(cacheBucket))
@@ -237,56 +445,277 @@ func (s *brandServiceImpl) getBrandByUUID(uuid string) (brand, bool, error) {
 	return cachedBrand, true, nil
 }
 
+func (s *brandServiceImpl) getCanonicalUUID(ctx context.Context, uuid string) (string, bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	_, span := startSpan(ctx, "cache.read", cacheQueryAttribute.String("concordance"))
+	defer span.End()
+	var canonicalUUID []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(concordanceBucket))
+		if bucket == nil {
+			return fmt.Errorf("Bucket %v not found!", concordanceBucket)
+		}
+		canonicalUUID = bucket.Get([]byte(uuid))
+		return nil
+	})
+
+	if err != nil {
+		log.Errorf("ERROR reading concordance for [%v]: %v", uuid, err.Error())
+		return "", false, err
+	}
+	return string(canonicalUUID), len(canonicalUUID) > 0, nil
+}
+
+func (s *brandServiceImpl) getConcordances(ctx context.Context) (*io.PipeReader, error) {
+	return s.streamCache(ctx, "concordances", func(tx *bolt.Tx, w io.Writer) error {
+		b := tx.Bucket([]byte(cacheBucket))
+		c := b.Cursor()
+		encoder := json.NewEncoder(w)
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var cachedBrand brand
+			if err := json.Unmarshal(v, &cachedBrand); err != nil {
+				return err
+			}
+			for _, concordance := range buildConcordances(cachedBrand) {
+				if err := encoder.Encode(concordance); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
 func (s *brandServiceImpl) openDB() error {
 	s.Lock()
 	defer s.Unlock()
 	log.Infof("Opening database '%v'.", s.cacheFileName)
 	if s.db == nil {
 		var err error
-		if s.db, err = bolt.Open(s.cacheFileName, 0600, &bolt.Options{Timeout: 1 * time.Second}); err != nil {
+		if s.db, err = bolt.Open(s.cacheFileName, 0600, &bolt.Options{Timeout: 1 * time.Second, InitialMmapSize: cacheMmapSize}); err != nil {
 			log.Errorf("ERROR opening cache file for init: %v.", err.Error())
 			return err
 		}
 	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{checkpointBucket, berthaBucket, auditBucket, accessDeniedBucket, quarantineBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *brandServiceImpl) resetCache() error {
+	s.Lock()
+	defer s.Unlock()
 	return s.createCacheBucket()
 }
 
-func (s *brandServiceImpl) reloadDB() error {
+func (s *brandServiceImpl) reloadDB(ctx context.Context, trigger reloadTrigger) error {
+	ctx, finish, err := s.beginReload(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+	return s.liveReload(ctx, trigger)
+}
+
+// startReloadDB - start a reload in the background, unless one is already running or the service is stopping
+func (s *brandServiceImpl) startReloadDB(trigger reloadTrigger) error {
+	ctx, finish, err := s.beginReload(context.Background())
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer finish()
+		if err := s.liveReload(ctx, trigger); err != nil {
+			log.Errorf("ERROR reloading db: %v", err.Error())
+		}
+	}()
+	return nil
+}
+
+func (s *brandServiceImpl) liveReload(ctx context.Context, trigger reloadTrigger) error {
+	if _, err := s.archive.begin(); err != nil {
+		log.Warnf("Cannot archive the reload payloads: %v", err.Error())
+	}
+	defer s.archive.finish()
+	return s.reload(ctx, liveReloadJob, trigger, s.taxonomies, s.uuidOverridesSource, s.berthaURL)
+}
+
+// replayDB - rebuild the cache from an archived reload without contacting TME or Bertha
+func (s *brandServiceImpl) replayDB(ctx context.Context, archiveID string, trigger reloadTrigger) error {
+	ctx, finish, err := s.beginReload(ctx)
+	if err != nil {
+		return err
+	}
+	defer finish()
+	return s.replay(ctx, archiveID, trigger)
+}
+
+// startReplayDB - start replaying the archive in the background, unless a reload is already running or the service is stopping
+func (s *brandServiceImpl) startReplayDB(archiveID string, trigger reloadTrigger) error {
+	if err := s.canReplay(archiveID); err != nil {
+		return err
+	}
+	ctx, finish, err := s.beginReload(context.Background())
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer finish()
+		if err := s.replay(ctx, archiveID, trigger); err != nil {
+			log.Errorf("ERROR replaying archive %s: %v", archiveID, err.Error())
+		}
+	}()
+	return nil
+}
+
+func (s *brandServiceImpl) replay(ctx context.Context, archiveID string, trigger reloadTrigger) error {
+	if err := s.canReplay(archiveID); err != nil {
+		return err
+	}
+	path, err := s.archive.path(archiveID)
+	if err != nil {
+		return err
+	}
+	berthaSource, err := s.archive.berthaSource(archiveID)
+	if err != nil {
+		return err
+	}
+	overridesSource, err := s.archive.uuidOverridesSource(archiveID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Replaying archive [%s]", archiveID)
+	var taxonomies []TmeTaxonomy
+	for _, taxonomy := range s.taxonomies {
+		repository := NewFileTmeRepository(path, taxonomy.Name, s.maxTmeRecords, new(BrandTransformer))
+		taxonomies = append(taxonomies, TmeTaxonomy{Name: taxonomy.Name, Repository: repository})
+	}
+	return s.reload(ctx, "replay:"+archiveID, trigger, taxonomies, overridesSource, berthaSource)
+}
+
+func (s *brandServiceImpl) canReplay(archiveID string) error {
+	if _, err := s.archive.berthaSource(archiveID); err != nil {
+		return err
+	}
+	if _, err := s.archive.uuidOverridesSource(archiveID); err != nil {
+		return err
+	}
+	resumed, err := s.archive.resumed(archiveID)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		return errArchiveResumed
+	}
+	return nil
+}
+
+// beginReload - mark a reload or replay as running, with a context cancelReload and StopReloads cancel.
+// Only one runs at a time, as they reset and write the same buckets: the others get errReloadInProgress.
+func (s *brandServiceImpl) beginReload(ctx context.Context) (context.Context, func(), error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.stopping {
+		return nil, nil, errServiceStopping
+	}
+	if s.reloading {
+		return nil, nil, errReloadInProgress
+	}
+	s.reloading = true
+	s.reloads.Add(1)
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancelRunningReload = cancel
+	return ctx, func() {
+		s.Lock()
+		s.reloading = false
+		s.cancelRunningReload = nil
+		s.Unlock()
+		cancel()
+		s.reloads.Done()
+	}, nil
+}
+
+func (s *brandServiceImpl) reload(ctx context.Context, job string, trigger reloadTrigger, taxonomies []TmeTaxonomy, overridesSource string, berthaSource string) error {
+	ctx, span := startSpan(ctx, "reload", attribute.String("job", job), attribute.String("trigger", trigger.Source), transactionIDAttribute.String(trigger.TransactionID))
+	err := s.runReload(ctx, job, trigger, taxonomies, overridesSource, berthaSource)
+	span.SetAttributes(attribute.String("status", s.getLastReload().Status))
+	endSpan(span, err)
+	return err
+}
+
+func (s *brandServiceImpl) runReload(ctx context.Context, job string, trigger reloadTrigger, taxonomies []TmeTaxonomy, overridesSource string, berthaSource string) error {
 	s.setDataLoaded(false)
+	s.startReloadResult(job, trigger)
+
+	overridesCtx, span := startSpan(ctx, "uuid-overrides.load")
+	overrides, err := loadUUIDOverrides(overridesCtx, overridesSource, s.httpClient)
+	endSpan(span, err)
+	if err != nil {
+		log.Errorf("Error on UUID overrides load: [%v]", err.Error())
+		s.finishReloadResult(reloadFailed, false, err)
+		return err
+	}
+	s.setUUIDOverrides(overrides)
+	s.archive.recordUUIDOverrides(overrides)
 
-	err := s.loadDB()
+	err = s.loadDB(ctx, job, taxonomies)
 	if err != nil {
 		log.Errorf("Error while creating BrandService: [%v]", err.Error())
 		s.setDataLoaded(false)
+		s.finishReloadResult(reloadFailed, false, err)
 		return err
 	}
 	var bBrands []berthaBrand
 
-	bBrands, err = s.getBerthaBrands(s.berthaURL)
+	bBrands, err = s.getBerthaBrands(ctx, berthaSource)
 	if err != nil {
 		log.Errorf("Error on Bertha load: [%v]", err.Error())
+		return s.applyBerthaFailurePolicy(ctx, err)
+	}
+	if job == liveReloadJob {
+		s.recordFetch(berthaDependency)
+	}
+	log.Infof("Loading curated brands from [%s]", berthaSource)
+	err = s.loadCuratedBrands(ctx, bBrands)
+	if err != nil {
+		log.Errorf("Error while loading in the curated brands: [%v]", err.Error())
 		s.setDataLoaded(false)
+		s.finishReloadResult(reloadFailed, false, err)
 		return err
-	} else {
-		err = s.loadCuratedBrands(bBrands)
-		if err != nil {
-			log.Errorf("Error while loading in the curated brands: [%v]", err.Error())
-			s.setDataLoaded(false)
-			return err
-		}
 	}
+	if err = s.putPreviousBerthaBrands(bBrands); err != nil {
+		log.Warnf("Cannot keep the curated brands for later reloads: %v", err.Error())
+	}
+	s.finishReloadResult(reloadSucceeded, true)
 
 	return nil
 }
 
-func (s *brandServiceImpl) loadDB() error {
+func (s *brandServiceImpl) loadDB(ctx context.Context, job string, taxonomies []TmeTaxonomy) (err error) {
+	ctx, span := startSpan(ctx, "tme.load")
+	defer func() {
+		endSpan(span, err)
+	}()
 	var wg sync.WaitGroup
 	log.Info("Loading DB...")
-	c := make(chan []brand)
-	go s.processBrands(c, &wg)
+	c := make(chan brandBatch)
+	done := make(chan struct{})
+	writeFailed := make(chan error, 1)
+	go s.processBrands(ctx, c, &wg, done, writeFailed)
 	defer func(w *sync.WaitGroup) {
 		close(c)
 		w.Wait()
+		<-done
 	}(&wg)
 
 	if err := s.openDB(); err != nil {
@@ -294,47 +723,113 @@ func (s *brandServiceImpl) loadDB() error {
 		return err
 	}
 
-	responseCount := 0
-	for {
-		terms, err := s.repository.GetTmeTermsFromIndex(responseCount)
-		if err != nil {
+	start, startRecord := 0, 0
+	resuming := false
+	if cp, found := s.getCheckpoint(job); found {
+		for i, taxonomy := range taxonomies {
+			if taxonomy.Name == cp.Taxonomy {
+				start, startRecord, resuming = i, cp.Offset, true
+				log.Infof("Resuming reload from TME taxonomy %s at record %d.", cp.Taxonomy, cp.Offset)
+				s.archive.recordResumed(cp)
+			}
+		}
+	}
+	if !resuming {
+		if err := s.resetCache(); err != nil {
 			return err
 		}
-		if len(terms) < 1 {
-			log.Info("Finished fetching brands from TME. Waiting subroutines to terminate.")
-			break
+	}
+
+	for i := start; i < len(taxonomies); i++ {
+		taxonomy := taxonomies[i]
+		responseCount := 0
+		if i == start {
+			responseCount = startRecord
 		}
+		for {
+			if err := ctx.Err(); err != nil {
+				return s.reloadCancelled(err)
+			}
+			select {
+			case err := <-writeFailed:
+				return err
+			default:
+			}
+			terms, err := s.getTmePage(ctx, taxonomy, responseCount)
+			if err != nil {
+				return err
+			}
+			if job == liveReloadJob {
+				s.recordFetch(tmeDependency)
+			}
+			if len(terms) < 1 {
+				log.Infof("Finished fetching brands from TME taxonomy %s. Waiting subroutines to terminate.", taxonomy.Name)
+				break
+			}
 
-		wg.Add(1)
-		s.processTerms(terms, c)
-		responseCount += s.maxTmeRecords
+			responseCount += s.maxTmeRecords
+			wg.Add(1)
+			s.processTerms(ctx, terms, taxonomy.Name, reloadCheckpoint{Job: job, Taxonomy: taxonomy.Name, Offset: responseCount}, c)
+		}
 	}
 
+	wg.Wait()
+	select {
+	case err := <-writeFailed:
+		return err
+	default:
+	}
+	s.setTmeBrandCount(s.countBrands())
+	if err := s.clearCheckpoint(); err != nil {
+		log.Warnf("Cannot clear reload checkpoint: %v", err.Error())
+	}
 	log.Info("Terms all processed.")
 	return nil
 }
 
-func (s *brandServiceImpl) processTerms(terms []interface{}, c chan<- []brand) {
+func (s *brandServiceImpl) processTerms(ctx context.Context, terms []interface{}, taxonomyName string, checkpoint reloadCheckpoint, c chan<- brandBatch) {
+	_, span := startSpan(ctx, "transform", attribute.String("taxonomy", taxonomyName), attribute.Int("terms", len(terms)))
 	log.Info("Processing terms...")
 	var cacheToBeWritten []brand
+	uuidOverrides := s.getUUIDOverrides()
 	for _, iTerm := range terms {
 		t := iTerm.(term)
-		cacheToBeWritten = append(cacheToBeWritten, transformBrand(t, s.taxonomyName))
+		cacheToBeWritten = append(cacheToBeWritten, transformBrand(t, taxonomyName, uuidOverrides))
 	}
-	c <- cacheToBeWritten
+	span.End()
+	c <- brandBatch{brands: cacheToBeWritten, checkpoint: checkpoint}
 }
 
-func (s *brandServiceImpl) processBrands(c <-chan []brand, wg *sync.WaitGroup) {
-	for brands := range c {
-		log.Infof("Processing batch of %v brands.", len(brands))
-		if err := s.db.Batch(func(tx *bolt.Tx) error {
+// processBrands - write each batch of brands to the cache with its checkpoint. Once a write fails, its error is sent on
+// failed and the later batches are dropped, so the checkpoint stays at the last page actually written.
+func (s *brandServiceImpl) processBrands(ctx context.Context, c <-chan brandBatch, wg *sync.WaitGroup, done chan<- struct{}, failed chan<- error) {
+	defer close(done)
+	writeFailed := false
+	for batch := range c {
+		if writeFailed {
+			wg.Done()
+			continue
+		}
+		log.Infof("Processing batch of %v brands.", len(batch.brands))
+		_, span := startSpan(ctx, "cache.batch-write", attribute.Int("brands", len(batch.brands)))
+		start := time.Now()
+		for i := range batch.brands {
+			if batch.brands[i].ParentUUID == "" {
+				batch.brands[i].ParentUUID = financialTimesBrandUuid
+			}
+		}
+		brands, invalid := s.screenBrands(batch.brands)
+		var collisions []brandWarning
+		err := s.db.Batch(func(tx *bolt.Tx) error {
 			bucket := tx.Bucket([]byte(cacheBucket))
 			if bucket == nil {
 				return fmt.Errorf("Cache bucket [%v] not found!", cacheBucket)
 			}
+			// Batch may run this more than once, so only the collisions of the run that commits are kept
+			collisions = nil
 			for _, anBrand := range brands {
-				if anBrand.ParentUUID == "" {
-					anBrand.ParentUUID = financialTimesBrandUuid
+				if collision, found := uuidCollision(bucket, anBrand); found {
+					collisions = append(collisions, collision)
 				}
 				marshalledBrand, err := json.Marshal(anBrand)
 
@@ -345,11 +840,27 @@ func (s *brandServiceImpl) processBrands(c <-chan []brand, wg *sync.WaitGroup) {
 				if err != nil {
 					return err
 				}
+				if err = putConcordances(tx, anBrand); err != nil {
+					return err
+				}
 			}
-			return nil
-		}); err != nil {
+			for _, q := range invalid {
+				if err := s.quarantineBrand(tx, q); err != nil {
+					return err
+				}
+			}
+			return putCheckpoint(tx, batch.checkpoint)
+		})
+		if err != nil {
 			log.Errorf("ERROR storing to cache: %+v.", err)
+			writeFailed = true
+			failed <- fmt.Errorf("Cannot write brands to the cache: %v", err)
+		} else {
+			s.recordInvalidBrands(invalid)
+			s.recordUUIDCollisions(collisions)
 		}
+		batchWriteDuration.Observe(time.Since(start).Seconds())
+		endSpan(span, err)
 		wg.Done()
 	}
 
@@ -359,36 +870,83 @@ func (s *brandServiceImpl) processBrands(c <-chan []brand, wg *sync.WaitGroup) {
 	}
 }
 
+// uuidCollision - whether the UUID of b was already written for a brand with another TME identifier, e.g. of another
+// taxonomy or through a UUID override, which b is about to replace
+func uuidCollision(bucket *bolt.Bucket, b brand) (brandWarning, bool) {
+	cachedValue := bucket.Get([]byte(b.UUID))
+	if cachedValue == nil {
+		return brandWarning{}, false
+	}
+	var previous brand
+	if err := json.Unmarshal(cachedValue, &previous); err != nil {
+		return brandWarning{}, false
+	}
+	previousIdentifier, identifier := firstTmeIdentifier(previous), firstTmeIdentifier(b)
+	if previousIdentifier == identifier {
+		return brandWarning{}, false
+	}
+	message := fmt.Sprintf("UUID collides with TME identifier %s (%s) of taxonomy %s, which it replaces", previousIdentifier, previous.PrefLabel, previous.Taxonomy)
+	log.Warnf("Brand %s (%s) of taxonomy %s: %s", identifier, b.PrefLabel, b.Taxonomy, message)
+	return brandWarning{UUID: b.UUID, PrefLabel: b.PrefLabel, TmeIdentifier: identifier, Message: message}, true
+}
+
+func firstTmeIdentifier(b brand) string {
+	if len(b.AlternativeIdentifiers.TME) == 0 {
+		return ""
+	}
+	return b.AlternativeIdentifiers.TME[0]
+}
+
+// recordUUIDCollisions - warn of the TME brands of a written batch that replaced a brand with the same UUID
+func (s *brandServiceImpl) recordUUIDCollisions(collisions []brandWarning) {
+	if len(collisions) == 0 {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.lastReload.Warnings = append(s.lastReload.Warnings, collisions...)
+}
+
 func (s *brandServiceImpl) createCacheBucket() error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		if tx.Bucket([]byte(cacheBucket)) != nil {
-			log.Infof("Deleting bucket '%v'.", cacheBucket)
-			if err := tx.DeleteBucket([]byte(cacheBucket)); err != nil {
-				log.Warnf("Cache bucket [%v] could not be deleted.", cacheBucket)
+		for _, name := range []string{cacheBucket, concordanceBucket, quarantineBucket} {
+			if tx.Bucket([]byte(name)) != nil {
+				log.Infof("Deleting bucket '%v'.", name)
+				if err := tx.DeleteBucket([]byte(name)); err != nil {
+					log.Warnf("Cache bucket [%v] could not be deleted.", name)
+				}
+			}
+			log.Infof("Creating bucket '%s'.", name)
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
 			}
 		}
-		log.Infof("Creating bucket '%s'.", cacheBucket)
-		_, err := tx.CreateBucket([]byte(cacheBucket))
-		return err
+		return nil
 	})
 }
 
-func (s *brandServiceImpl) getBerthaBrands(berthaURL string) ([]berthaBrand, error) {
-	req, err := http.NewRequest("GET", berthaURL, nil)
+func (s *brandServiceImpl) getBerthaBrands(ctx context.Context, berthaURL string) (bBrands []berthaBrand, err error) {
+	ctx, span := startSpan(ctx, "bertha.fetch")
+	defer func() {
+		span.SetAttributes(attribute.Int("rows", len(bBrands)))
+		endSpan(span, err)
+	}()
+	start := time.Now()
+	contents, err := readSource(ctx, berthaURL, s.httpClient)
+	berthaFetchDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
 		return []berthaBrand{}, err
 	}
-
-	res, err := s.httpClient.Do(req)
-	if err != nil {
-		return []berthaBrand{}, err
+	isCSV := isCSVSource(berthaURL)
+	if isCSV {
+		s.archive.recordBertha("csv", contents)
+	} else {
+		s.archive.recordBertha("json", contents)
 	}
-	var bBrands []berthaBrand
-	err = json.NewDecoder(res.Body).Decode(&bBrands)
-	return bBrands, err
+	return parseBerthaBrands(contents, isCSV, s.berthaCSVColumns)
 }
 
-func getBrandUUID(b berthaBrand) string {
+func getBrandUUID(b berthaBrand, uuidOverrides map[string]string) string {
 	if b.TmeIdentifier == "" {
 		return ""
 	}
@@ -397,44 +955,60 @@ func getBrandUUID(b berthaBrand) string {
 		return financialTimesBrandUuid
 	}
 
-	var brandUUID string
-
-	if val, ok := berthaUUIDmap()[b.TmeIdentifier]; ok {
-		brandUUID = val
-	} else {
-		brandUUID = uuid.NewMD5(uuid.UUID{}, []byte(b.TmeIdentifier)).String()
-	}
-
-	return brandUUID
+	return tmeUUID(b.TmeIdentifier, uuidOverrides)
 }
 
-func (s *brandServiceImpl) loadCuratedBrands(bBrands []berthaBrand) error {
+func (s *brandServiceImpl) loadCuratedBrands(ctx context.Context, bBrands []berthaBrand) (err error) {
+	_, span := startSpan(ctx, "bertha.merge", attribute.Int("rows", len(bBrands)))
+	defer func() {
+		endSpan(span, err)
+	}()
 	s.Lock()
 	defer s.Unlock()
-	log.Infof("Loading curated brands from [%s]", s.berthaURL)
-	err := s.db.Batch(func(tx *bolt.Tx) error {
+	var counts reloadCounts
+	var warnings []brandWarning
+	err = s.db.Batch(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(cacheBucket))
 		if bucket == nil {
 			return fmt.Errorf("Cache bucket [%v] not found!", cacheBucket)
 		}
+		counts = reloadCounts{BerthaRows: len(bBrands)}
+		warnings = nil
 
 		for _, b := range bBrands {
-			brandUUID := getBrandUUID(b)
+			brandUUID := getBrandUUID(b, s.uuidOverrides)
 			if brandUUID == "" {
 				// We've put this check in because editorial sometimes forget the TME Identifier.
 				log.Warnf("No TME Identifier, ignoring curated brand %s (TmeParentIdentifier[%s], TmeIdentifier[%s])", b.PrefLabel, b.TmeParentIdentifier, b.TmeIdentifier)
+				counts.SkippedBerthaRows++
+				warnings = append(warnings, brandWarning{PrefLabel: b.PrefLabel, Message: "No TME Identifier, ignoring curated brand"})
 				continue
 			}
 
 			cachedBrand := bucket.Get([]byte(brandUUID))
 			var a brand
 			if cachedBrand == nil {
-				log.Warnf("Curated brand %s [%s] was not found in cache.  Adding without V1 information.", b.PrefLabel, brandUUID)
 				a, _ = berthaToBrand(b, brandUUID)
 			} else {
 				json.Unmarshal(cachedBrand, &a)
 				a, _ = addBerthaInformation(a, b)
-
+			}
+			if violations := s.brandViolations(a); len(violations) > 0 {
+				// An invalid curated brand leaves the TME brand, if there is one, as it was.
+				invalid := quarantinedBrand{Brand: a, Violations: violations}
+				counts.InvalidBrands++
+				warnings = append(warnings, s.invalidBrandWarning(invalid))
+				if err := s.quarantineBrand(tx, invalid); err != nil {
+					return err
+				}
+				continue
+			}
+			if cachedBrand == nil {
+				log.Warnf("Curated brand %s [%s] was not found in cache.  Adding without V1 information.", b.PrefLabel, brandUUID)
+				counts.CuratedOnlyBrands++
+				warnings = append(warnings, brandWarning{UUID: brandUUID, PrefLabel: b.PrefLabel, TmeIdentifier: b.TmeIdentifier, Message: "Curated brand was not found in cache, adding without V1 information"})
+			} else {
+				counts.CuratedBrands++
 				bucket.Delete([]byte(brandUUID))
 			}
 			newCachedVersion, _ := json.Marshal(a)
@@ -442,10 +1016,19 @@ func (s *brandServiceImpl) loadCuratedBrands(bBrands []berthaBrand) error {
 			if err != nil {
 				return err
 			}
+			if err = putConcordances(tx, a); err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
+	if err == nil {
+		counts.TmeBrands = s.lastReload.Counts.TmeBrands
+		counts.InvalidBrands += s.lastReload.Counts.InvalidBrands
+		s.lastReload.Counts = counts
+		s.lastReload.Warnings = append(s.lastReload.Warnings, warnings...)
+	}
 
 	log.Info("Done loading curated brands.")
 	return err
@@ -469,6 +1052,7 @@ func addBerthaInformation(a brand, b berthaBrand) (brand, error) {
 	a.DescriptionXML = b.DescriptionXML
 	a.ImageURL = b.ImageURL
 	a.Type = "Brand"
+	a.Uncurated = false
 
 	return a, nil
 }
@@ -510,3 +1094,31 @@ func berthaToBrand(a berthaBrand, brandUUID string) (brand, error) {
 
 	return p, err
 }
+
+func buildConcordances(b brand) []brandConcordance {
+	var concordances []brandConcordance
+	for _, altUUID := range b.AlternativeIdentifiers.UUIDs {
+		concordances = append(concordances, brandConcordance{Identifier: altUUID, Authority: uuidAuthority, CanonicalUUID: b.UUID})
+	}
+	for _, tmeIdentifier := range b.AlternativeIdentifiers.TME {
+		concordances = append(concordances, brandConcordance{Identifier: tmeIdentifier, Authority: tmeAuthority, CanonicalUUID: b.UUID})
+	}
+	return concordances
+}
+
+// putConcordances - index every alternative UUID of a brand against its canonical UUID
+func putConcordances(tx *bolt.Tx, b brand) error {
+	bucket := tx.Bucket([]byte(concordanceBucket))
+	if bucket == nil {
+		return fmt.Errorf("Cache bucket [%v] not found!", concordanceBucket)
+	}
+	for _, altUUID := range b.AlternativeIdentifiers.UUIDs {
+		if altUUID == b.UUID {
+			continue
+		}
+		if err := bucket.Put([]byte(altUUID), []byte(b.UUID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
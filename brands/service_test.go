@@ -2,11 +2,13 @@ package brands
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -17,6 +19,8 @@ import (
 
 	"github.com/Financial-Times/tme-reader/tmereader"
 	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,7 +42,7 @@ func (c *mockClient) Do(req *http.Request) (*http.Response, error) {
 		c.err = e
 	}
 	cb := ioutil.NopCloser(bytes.NewReader(b))
-	return &http.Response{Body: cb}, c.err
+	return &http.Response{StatusCode: http.StatusOK, Body: cb}, c.err
 }
 
 const (
@@ -55,6 +59,8 @@ var bobTMEBrand = brand{
 	AlternativeIdentifiers: alternativeIdentifiers{TME: []string{"Ym9i-QnJhbmRz"}, UUIDs: []string{bobUuid}},
 	Aliases:                []string{"Bob"},
 	Type:                   "Brand",
+	Taxonomy:               "Brands",
+	Uncurated:              true,
 }
 
 var fredTMEBrand = brand{
@@ -64,6 +70,8 @@ var fredTMEBrand = brand{
 	AlternativeIdentifiers: alternativeIdentifiers{TME: []string{"ZnJlZA==-QnJhbmRz"}, UUIDs: []string{fredUuid}},
 	Aliases:                []string{"Fred"},
 	Type:                   "Brand",
+	Taxonomy:               "Brands",
+	Uncurated:              true,
 }
 
 var testBerthaBrand = berthaBrand{
@@ -105,6 +113,7 @@ var expectedBrandFixedUUID = brand{
 	ParentUUID:     financialTimesBrandUuid,
 	PrefLabel:      "FT Data",
 	Type:           "Brand",
+	Taxonomy:       "Brands",
 	Strapline:      "Strapline",
 	Description:    "DescriptionXML",
 	DescriptionXML: "<p>DescriptionXML</p>",
@@ -152,6 +161,114 @@ func TestInit(t *testing.T) {
 	assert.True(t, service.isInitialised())
 }
 
+func TestAbandonedStreamReleasesCache(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pv, err := service.getBrands(ctx, brandFilter{}, nil)
+	assert.NoError(t, err)
+	cancel()
+
+	locked := make(chan struct{})
+	go func() {
+		service.(*brandServiceImpl).setDataLoaded(true)
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Abandoned stream still holds the cache")
+	}
+	_, err = pv.Read(make([]byte, 1024))
+	assert.Error(t, err)
+}
+
+func TestStreamDoesNotHoldTheLock(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+	impl := service.(*brandServiceImpl)
+
+	pv, err := service.getBrands(context.Background(), brandFilter{}, nil)
+	assert.NoError(t, err)
+
+	written := make(chan error, 1)
+	go func() {
+		impl.setDataLoaded(true)
+		written <- impl.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(cacheBucket)).Put([]byte(testUUID), []byte(`{"uuid":"`+testUUID+`"}`))
+		})
+	}()
+	select {
+	case err := <-written:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Error("An unread stream holds the service locked")
+	}
+
+	var body []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := pv.Read(buf)
+		body = append(body, buf[:n]...)
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+	assert.Equal(t, 2, strings.Count(string(body), "\n"), "The stream reads the cache as it was when it started")
+	assertCount(t, service, 3)
+}
+
+func TestShutdownWaitsForStreamsWithoutHoldingTheLock(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+
+	pv, err := service.getBrands(context.Background(), brandFilter{}, nil)
+	assert.NoError(t, err)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- service.Shutdown()
+	}()
+	for service.isInitialised() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-closed:
+		t.Fatal("The cache was closed while a stream was reading it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.False(t, service.isDataLoaded(), "The service can be queried while shutdown waits for the stream")
+
+	refused, err := service.getBrands(context.Background(), brandFilter{}, nil)
+	assert.NoError(t, err)
+	_, err = refused.Read(make([]byte, 1024))
+	assert.Equal(t, errServiceStopping, err, "No stream starts once shutdown has begun")
+
+	_, err = ioutil.ReadAll(pv)
+	assert.NoError(t, err)
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown didn't close the cache once the stream finished")
+	}
+}
+
 func TestGetBrands(t *testing.T) {
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
@@ -160,7 +277,7 @@ func TestGetBrands(t *testing.T) {
 	defer service.Shutdown()
 	waitTillInit(t, service)
 	waitTillDataLoaded(t, service)
-	pv, err := service.getBrands()
+	pv, err := service.getBrands(context.Background(), brandFilter{}, nil)
 
 	var wg sync.WaitGroup
 	var res []brand
@@ -176,7 +293,7 @@ func TestGetBrands(t *testing.T) {
 			res = append(res, p)
 		}
 		wg.Done()
-	}(&pv, &wg)
+	}(pv, &wg)
 	wg.Wait()
 
 	assert.NoError(t, err)
@@ -194,7 +311,7 @@ func TestGetBrandUUIDs(t *testing.T) {
 	defer service.Shutdown()
 	waitTillInit(t, service)
 	waitTillDataLoaded(t, service)
-	pv, err := service.getBrandUUIDs()
+	pv, err := service.getBrandUUIDs(context.Background(), brandFilter{})
 
 	var wg sync.WaitGroup
 	var res []brandUUID
@@ -210,7 +327,7 @@ func TestGetBrandUUIDs(t *testing.T) {
 			res = append(res, p)
 		}
 		wg.Done()
-	}(&pv, &wg)
+	}(pv, &wg)
 	wg.Wait()
 
 	assert.NoError(t, err)
@@ -228,20 +345,20 @@ func TestGetBrandLinks(t *testing.T) {
 	defer service.Shutdown()
 	waitTillInit(t, service)
 	waitTillDataLoaded(t, service)
-	pv, err := service.getBrandLinks()
+	pv, err := service.getBrandLinks(context.Background())
 
 	var wg sync.WaitGroup
 	var res []brandLink
 	wg.Add(1)
 	go func(reader io.Reader, w *sync.WaitGroup) {
-		var err error
-		jsonBlob, err := ioutil.ReadAll(reader)
-		assert.NoError(t, err)
-		log.Infof("Got bytes: %v", string(jsonBlob[:]))
-		err = json.Unmarshal(jsonBlob, &res)
-		assert.NoError(t, err)
+		decoder := json.NewDecoder(reader)
+		for decoder.More() {
+			var link brandLink
+			assert.NoError(t, decoder.Decode(&link))
+			res = append(res, link)
+		}
 		wg.Done()
-	}(&pv, &wg)
+	}(pv, &wg)
 	wg.Wait()
 
 	assert.NoError(t, err)
@@ -267,12 +384,11 @@ func TestReload(t *testing.T) {
 	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
 	service := createTestBrandService(&repo, tmpfile.Name())
 	defer service.Shutdown()
-	waitTillInit(t, service)
-	waitTillDataLoaded(t, service)
+	waitTillReloadFinished(t, service)
 	assertCount(t, service, 2)
 	repo.terms = append(repo.terms, term{CanonicalName: "Third", RawID: "third"})
 	repo.count = 0
-	assert.NoError(t, service.reloadDB())
+	assert.NoError(t, service.reloadDB(context.Background(), reloadTrigger{}))
 	waitTillInit(t, service)
 	waitTillDataLoaded(t, service)
 	assertCount(t, service, 3)
@@ -282,7 +398,7 @@ func TestFailedReloadNoBertha(t *testing.T) {
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
 	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
-	service := NewBrandService(&repo, "/base/url", "Brands", 1, tmpfile.Name(), "bertha/url", &mockClient{err: errors.New("bertha fail")})
+	service := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&mockClient{err: errors.New("bertha fail")}))
 
 	defer service.Shutdown()
 	waitTillInit(t, service)
@@ -295,7 +411,7 @@ func TestFailedReloadNoTME(t *testing.T) {
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
 	repo := dummyRepo{err: errors.New("TME Fail"), terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
-	service := NewBrandService(&repo, "/base/url", "Brands", 1, tmpfile.Name(), "bertha/url", &mockClient{})
+	service := createTestBrandService(&repo, tmpfile.Name())
 
 	defer service.Shutdown()
 	waitTillInit(t, service)
@@ -316,7 +432,7 @@ func TestGetBrandByUUID(t *testing.T) {
 		{"Success", "132a00d6-966c-3afb-b5c6-35da4f0dd70e", true, nil},
 		{"Success", "xxxxxxxx-bb56-363d-80c1-f2d957ef58cf", false, nil}}
 	for _, test := range tests {
-		brand, found, err := service.getBrandByUUID(test.uuid)
+		brand, found, err := service.getBrandByUUID(context.Background(), test.uuid)
 		if test.err != nil {
 			assert.Equal(t, test.err, err)
 		} else if test.found {
@@ -328,6 +444,100 @@ func TestGetBrandByUUID(t *testing.T) {
 	}
 }
 
+func TestGetBrandsFromMultipleTaxonomies(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	brandsRepo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	sectionsRepo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	taxonomies := []TmeTaxonomy{{Name: "Brands", Repository: &brandsRepo}, {Name: "Sections", Repository: &sectionsRepo}}
+	service := createTestBrandService(nil, tmpfile.Name(), func(c *ServiceConfig) { c.Taxonomies = taxonomies })
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+	assertCount(t, service, 2)
+
+	actualBrand, found, err := service.getBrandByUUID(context.Background(), bobUuid)
+	assert.True(t, found)
+	assert.NoError(t, err)
+	compareBrands(actualBrand, bobTMEBrand, t)
+
+	sectionIdentifier := buildTmeIdentifier("bob", "Sections")
+	sectionUUID := uuid.NewMD5(uuid.UUID{}, []byte(sectionIdentifier)).String()
+	actualBrand, found, err = service.getBrandByUUID(context.Background(), sectionUUID)
+	assert.True(t, found)
+	assert.NoError(t, err)
+	assert.Equal(t, "Sections", actualBrand.Taxonomy)
+	assert.Equal(t, []string{sectionIdentifier}, actualBrand.AlternativeIdentifiers.TME)
+}
+
+func TestUUIDCollisionBetweenTaxonomiesIsWarned(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	overridesFile := getTempFile(t)
+	defer os.Remove(overridesFile.Name())
+	sectionIdentifier := buildTmeIdentifier("bob", "Sections")
+	assert.NoError(t, ioutil.WriteFile(overridesFile.Name(), []byte(`{"`+sectionIdentifier+`": "`+bobUuid+`"}`), 0600))
+	brandsRepo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	sectionsRepo := dummyRepo{terms: []term{{CanonicalName: "Bob's section", RawID: "bob"}}}
+	taxonomies := []TmeTaxonomy{{Name: "Brands", Repository: &brandsRepo}, {Name: "Sections", Repository: &sectionsRepo}}
+	service := createTestBrandService(nil, tmpfile.Name(), func(c *ServiceConfig) { c.Taxonomies = taxonomies }, func(c *ServiceConfig) { c.UUIDOverridesSource = overridesFile.Name() })
+	defer service.Shutdown()
+	waitTillReloadFinished(t, service)
+	assertCount(t, service, 1)
+
+	warnings := service.getLastReload().Warnings
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, bobUuid, warnings[0].UUID)
+		assert.Equal(t, sectionIdentifier, warnings[0].TmeIdentifier)
+		assert.Contains(t, warnings[0].Message, buildTmeIdentifier("bob", "Brands"))
+	}
+}
+
+func TestGetCanonicalUUID(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Business blog", RawID: "Brands_86"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+
+	canonicalUUID, found, err := service.getCanonicalUUID(context.Background(), "0312776d-bac4-3118-bc76-b93b2cd3f1ba")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "fd4459b2-cc4e-4ec8-9853-c5238eb860fb", canonicalUUID)
+
+	_, found, err = service.getCanonicalUUID(context.Background(), fredUuid)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestGetConcordances(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Business blog", RawID: "Brands_86"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+	pv, err := service.getConcordances(context.Background())
+	assert.NoError(t, err)
+
+	var res []brandConcordance
+	scan := bufio.NewScanner(pv)
+	for scan.Scan() {
+		var c brandConcordance
+		assert.NoError(t, json.Unmarshal(scan.Bytes(), &c))
+		res = append(res, c)
+	}
+
+	assert.Equal(t, []brandConcordance{
+		{Identifier: "0312776d-bac4-3118-bc76-b93b2cd3f1ba", Authority: uuidAuthority, CanonicalUUID: "fd4459b2-cc4e-4ec8-9853-c5238eb860fb"},
+		{Identifier: "fd4459b2-cc4e-4ec8-9853-c5238eb860fb", Authority: uuidAuthority, CanonicalUUID: "fd4459b2-cc4e-4ec8-9853-c5238eb860fb"},
+		{Identifier: "QnJhbmRzXzg2-QnJhbmRz", Authority: tmeAuthority, CanonicalUUID: "fd4459b2-cc4e-4ec8-9853-c5238eb860fb"},
+	}, res)
+}
+
 func TestBerthaToBrand(t *testing.T) {
 	actualBrand, err := berthaToBrand(testBerthaBrand, "e807f1fc-f82d-332f-9bb0-18ca6738a19f")
 	assert.Equal(t, expectedBrand, actualBrand)
@@ -353,14 +563,14 @@ func TestLoadingCuratedBrands(t *testing.T) {
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
 
-	brandService := NewBrandService(&dummyRepo{}, "/base/url", "Brands", 1, tmpfile.Name(), "/bertha/url", &mockClient{})
+	brandService := createTestBrandService(&dummyRepo{}, tmpfile.Name())
 	input := []berthaBrand{testBerthaBrand}
 
 	waitTillInit(t, brandService)
 	waitTillDataLoaded(t, brandService)
 
-	brandService.loadCuratedBrands(input)
-	actualOutput, found, err := brandService.getBrandByUUID("e807f1fc-f82d-332f-9bb0-18ca6738a19f")
+	brandService.loadCuratedBrands(context.Background(), input)
+	actualOutput, found, err := brandService.getBrandByUUID(context.Background(), "e807f1fc-f82d-332f-9bb0-18ca6738a19f")
 	assert.Equal(t, true, found)
 	assert.EqualValues(t, expectedBrand, actualOutput)
 	assert.Nil(t, err)
@@ -370,7 +580,7 @@ func TestNoTmeIdentifierWhenLoadingCuratedBrandsThenBrandIsIgnored(t *testing.T)
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
 
-	brandService := NewBrandService(&dummyRepo{}, "/base/url", "Brands", 1, tmpfile.Name(), "/bertha/url", &mockClient{})
+	brandService := createTestBrandService(&dummyRepo{}, tmpfile.Name())
 
 	testBerthaBrandWithTme := berthaBrand{
 		Active:              true,
@@ -383,9 +593,9 @@ func TestNoTmeIdentifierWhenLoadingCuratedBrandsThenBrandIsIgnored(t *testing.T)
 	waitTillInit(t, brandService)
 	waitTillDataLoaded(t, brandService)
 
-	brandService.loadCuratedBrands(input)
+	brandService.loadCuratedBrands(context.Background(), input)
 
-	actualOutput, err := brandService.getCount()
+	actualOutput, err := brandService.getCount(context.Background())
 	assert.NoError(t, err)
 	assert.EqualValues(t, 0, actualOutput)
 }
@@ -394,34 +604,34 @@ func TestSetsParentBrandToBeFinacialTimesIfNoOtherParentSetFromBertha(t *testing
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
 
-	brandService := NewBrandService(&dummyRepo{}, "/base/url", "Brands", 1, tmpfile.Name(), "/bertha/url", &mockClient{})
+	brandService := createTestBrandService(&dummyRepo{}, tmpfile.Name())
 	input := []berthaBrand{testBerthaBrand}
 	waitTillInit(t, brandService)
 	waitTillDataLoaded(t, brandService)
 
-	brandService.loadCuratedBrands(input)
-	actualOutput, found, err := brandService.getBrandByUUID("e807f1fc-f82d-332f-9bb0-18ca6738a19f")
+	brandService.loadCuratedBrands(context.Background(), input)
+	actualOutput, found, err := brandService.getBrandByUUID(context.Background(), "e807f1fc-f82d-332f-9bb0-18ca6738a19f")
 	assert.Equal(t, true, found)
 	assert.EqualValues(t, expectedBrand, actualOutput)
 	assert.Nil(t, err)
 }
 
-//  Replaces data from TME with Bertha updates
+// Replaces data from TME with Bertha updates
 func TestBerthaLoadedCorrectly(t *testing.T) {
 	tmpfile := getTempFile(t)
 	defer os.Remove(tmpfile.Name())
 	repo := dummyRepo{terms: []term{{CanonicalName: "awesome brand", RawID: "some tme identifier"}, {CanonicalName: "FT Data", RawID: "0f6e4716-b2b5-485a-9da9-76e777a719f2"}}}
 	client := mockClient{resp: []berthaBrand{testBerthaBrand, testBerthaBrandFixedUUID}}
-	brandService := NewBrandService(&repo, "/base/url", "Brands", 1, tmpfile.Name(), "/bertha/url", &client)
+	brandService := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&client))
 
 	waitTillInit(t, brandService)
 	waitTillDataLoaded(t, brandService)
 
-	reader, err := brandService.getBrands()
+	reader, err := brandService.getBrands(context.Background(), brandFilter{}, nil)
 	assert.NoError(t, err)
-	printBrands(&reader)
+	printBrands(reader)
 	assertCount(t, brandService, 3)
-	actualBrand, found, err := brandService.getBrandByUUID(expectedBrandFixedUUID.UUID)
+	actualBrand, found, err := brandService.getBrandByUUID(context.Background(), expectedBrandFixedUUID.UUID)
 	assert.True(t, found)
 	assert.NoError(t, err)
 	assert.EqualValues(t, expectedBrandFixedUUID, actualBrand)
@@ -432,29 +642,45 @@ func TestBerthaLoadedFTCorrectly(t *testing.T) {
 	defer os.Remove(tmpfile.Name())
 	repo := dummyRepo{terms: []term{}}
 	client := mockClient{resp: []berthaBrand{testBerthaBrandForFT}}
-	brandService := NewBrandService(&repo, "/base/url", "Brands", 1, tmpfile.Name(), "/bertha/url", &client)
+	brandService := createTestBrandService(&repo, tmpfile.Name(), withHTTPClient(&client))
 
 	waitTillInit(t, brandService)
 	waitTillDataLoaded(t, brandService)
 
-	reader, err := brandService.getBrands()
+	reader, err := brandService.getBrands(context.Background(), brandFilter{}, nil)
 	assert.NoError(t, err)
-	printBrands(&reader)
+	printBrands(reader)
 	assertCount(t, brandService, 1)
-	actualBrand, found, err := brandService.getBrandByUUID(financialTimesBrandUuid)
+	actualBrand, found, err := brandService.getBrandByUUID(context.Background(), financialTimesBrandUuid)
 	assert.True(t, found)
 	assert.NoError(t, err)
 	assert.EqualValues(t, expectedBrandFT, actualBrand)
 }
 
 func assertCount(t *testing.T, s BrandService, expected int) {
-	count, err := s.getCount()
+	count, err := s.getCount(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, expected, count)
 }
 
-func createTestBrandService(repo tmereader.Repository, cacheFileName string) BrandService {
-	return NewBrandService(repo, "/base/url", "Brands", 1, cacheFileName, "bertha/url", &mockClient{})
+// createTestBrandService - a brand service of the repository's brands, with the configuration changed by any overrides
+func createTestBrandService(repo tmereader.Repository, cacheFileName string, overrides ...func(*ServiceConfig)) BrandService {
+	config := ServiceConfig{
+		Taxonomies:    []TmeTaxonomy{{Name: "Brands", Repository: repo}},
+		BaseURL:       "/base/url",
+		MaxTmeRecords: 1,
+		CacheFileName: cacheFileName,
+		BerthaURL:     "http://bertha/url",
+		HTTPClient:    &mockClient{},
+	}
+	for _, override := range overrides {
+		override(&config)
+	}
+	return NewBrandService(config)
+}
+
+func withHTTPClient(client httpClient) func(*ServiceConfig) {
+	return func(c *ServiceConfig) { c.HTTPClient = client }
 }
 
 func getTempFile(t *testing.T) *os.File {
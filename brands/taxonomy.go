@@ -5,9 +5,19 @@ type taxonomy struct {
 }
 
 type term struct {
-	CanonicalName string  `xml:"name"`
-	RawID         string  `xml:"id"`
-	Aliases       aliases `xml:"variations"`
+	CanonicalName    string        `xml:"name"`
+	RawID            string        `xml:"id"`
+	Aliases          aliases       `xml:"variations"`
+	Enabled          *bool         `xml:"enabled"`
+	Parent           *relatedTerm  `xml:"parent"`
+	Broader          []relatedTerm `xml:"broader>term"`
+	CreatedDate      string        `xml:"createdDate"`
+	LastModifiedDate string        `xml:"lastModifiedDate"`
+}
+
+type relatedTerm struct {
+	CanonicalName string `xml:"name"`
+	RawID         string `xml:"id"`
 }
 
 type aliases struct {
@@ -0,0 +1,116 @@
+package brands
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+	return recorder
+}
+
+func spansByName(recorder *tracetest.SpanRecorder) map[string][]sdktrace.ReadOnlySpan {
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	return spans
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestReloadIsTraced(t *testing.T) {
+	recorder := recordSpans(t)
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}, {CanonicalName: "Fred", RawID: "fred"}}}
+	s := &brandServiceImpl{taxonomies: []TmeTaxonomy{{Name: "Brands", Repository: &repo}}, maxTmeRecords: 1, initialised: true, cacheFileName: tmpfile.Name(), berthaURL: "http://bertha/url", uuidOverrides: berthaUUIDmap(), httpClient: &mockClient{resp: []berthaBrand{testBerthaBrand}}}
+	defer s.Shutdown()
+
+	assert.NoError(t, s.reloadDB(context.Background(), reloadTrigger{Source: requestTrigger, TransactionID: "tid_reload"}))
+
+	spans := spansByName(recorder)
+	if !assert.Len(t, spans["reload"], 1) {
+		return
+	}
+	reload := spans["reload"][0]
+	assert.Equal(t, "tid_reload", spanAttribute(reload, transactionIDAttribute).AsString())
+	assert.Equal(t, reloadSucceeded, spanAttribute(reload, "status").AsString())
+	for name, count := range map[string]int{"uuid-overrides.load": 1, "tme.load": 1, "tme.page": 3, "transform": 2, "cache.batch-write": 2, "bertha.fetch": 1, "bertha.merge": 1} {
+		assert.Len(t, spans[name], count, name)
+		for _, span := range spans[name] {
+			assert.Equal(t, reload.SpanContext().TraceID(), span.SpanContext().TraceID(), name)
+		}
+	}
+	assert.Equal(t, reload.SpanContext().SpanID(), spans["tme.load"][0].Parent().SpanID())
+	assert.Equal(t, spans["tme.load"][0].SpanContext().SpanID(), spans["tme.page"][0].Parent().SpanID())
+}
+
+func TestRequestIsTraced(t *testing.T) {
+	recorder := recordSpans(t)
+	req := newRequest("GET", "/transformers/brands/__count")
+	req.Header.Set("X-Request-Id", "tid_count")
+	rec := httptest.NewRecorder()
+	router(&dummyService{initialised: true, dataLoaded: true, count: 2}).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	spans := spansByName(recorder)
+	if assert.Len(t, spans["GET /transformers/brands/__count"], 1) {
+		span := spans["GET /transformers/brands/__count"][0]
+		assert.Equal(t, "tid_count", spanAttribute(span, transactionIDAttribute).AsString())
+		assert.Equal(t, int64(http.StatusOK), spanAttribute(span, "http.status_code").AsInt64())
+	}
+}
+
+func TestCacheReadIsTraced(t *testing.T) {
+	tmpfile := getTempFile(t)
+	defer os.Remove(tmpfile.Name())
+	repo := dummyRepo{terms: []term{{CanonicalName: "Bob", RawID: "bob"}}}
+	service := createTestBrandService(&repo, tmpfile.Name())
+	defer service.Shutdown()
+	waitTillInit(t, service)
+	waitTillDataLoaded(t, service)
+
+	recorder := recordSpans(t)
+	ctx, span := startSpan(context.Background(), "request")
+	_, _, err := service.getBrandByUUID(ctx, bobUuid)
+	assert.NoError(t, err)
+	span.End()
+
+	spans := spansByName(recorder)
+	if assert.Len(t, spans["cache.read"], 1) {
+		assert.Equal(t, "brand", spanAttribute(spans["cache.read"][0], cacheQueryAttribute).AsString())
+		assert.Equal(t, span.SpanContext().SpanID(), spans["cache.read"][0].Parent().SpanID())
+	}
+}
+
+func TestInitTracing(t *testing.T) {
+	stop, err := InitTracing(context.Background(), NoTraceExporter, "v1-brands-transformer")
+	assert.NoError(t, err)
+	assert.NoError(t, stop(context.Background()))
+
+	_, err = InitTracing(context.Background(), "zipkin", "v1-brands-transformer")
+	assert.Error(t, err)
+}
@@ -3,16 +3,28 @@ package brands
 import (
 	"encoding/base64"
 	"encoding/xml"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/pborman/uuid"
 )
 
+var tmeDateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
 // BrandTransformer struct
 type BrandTransformer struct {
+	archive      *PayloadArchive
+	taxonomyName string
+}
+
+// NewArchivingBrandTransformer - create a BrandTransformer that records every raw taxonomy page it unmarshals to the archive
+func NewArchivingBrandTransformer(archive *PayloadArchive, taxonomyName string) *BrandTransformer {
+	return &BrandTransformer{archive: archive, taxonomyName: taxonomyName}
 }
 
 // UnMarshallTaxonomy - unmarshal the XML of a taxonomy
-func (*BrandTransformer) UnMarshallTaxonomy(contents []byte) ([]interface{}, error) {
+func (bt *BrandTransformer) UnMarshallTaxonomy(contents []byte) ([]interface{}, error) {
+	bt.archive.recordTmePage(bt.taxonomyName, contents)
 	t := taxonomy{}
 	err := xml.Unmarshal(contents, &t)
 	if err != nil {
@@ -35,26 +47,65 @@ func (*BrandTransformer) UnMarshallTerm(content []byte) (interface{}, error) {
 	return dummyTerm, nil
 }
 
-func transformBrand(tmeTerm term, taxonomyName string) brand {
+func transformBrand(tmeTerm term, taxonomyName string, uuidOverrides map[string]string) brand {
 	tmeIdentifier := buildTmeIdentifier(tmeTerm.RawID, taxonomyName)
 	brandUUID := uuid.NewMD5(uuid.UUID{}, []byte(tmeIdentifier)).String()
 	uuidList := []string{brandUUID}
-	if val, ok := berthaUUIDmap()[tmeIdentifier]; ok {
+	if val, ok := uuidOverrides[tmeIdentifier]; ok {
 		brandUUID = val
 		uuidList = append(uuidList, val)
 	}
 
+	var parentUUID string
+	if tmeTerm.Parent != nil && tmeTerm.Parent.RawID != "" {
+		parentUUID = tmeUUID(buildTmeIdentifier(tmeTerm.Parent.RawID, taxonomyName), uuidOverrides)
+	}
+
+	var broaderUUIDs []string
+	for _, broader := range tmeTerm.Broader {
+		broaderUUIDs = append(broaderUUIDs, tmeUUID(buildTmeIdentifier(broader.RawID, taxonomyName), uuidOverrides))
+	}
+
 	aliasList := buildAliasList(tmeTerm.Aliases, tmeTerm.CanonicalName)
 	return brand{
-		UUID:      brandUUID,
-		PrefLabel: tmeTerm.CanonicalName,
+		UUID:       brandUUID,
+		ParentUUID: parentUUID,
+		PrefLabel:  tmeTerm.CanonicalName,
 		AlternativeIdentifiers: alternativeIdentifiers{
 			TME:   []string{tmeIdentifier},
 			UUIDs: removeDuplicates(uuidList),
 		},
-		Type:    "Brand",
-		Aliases: aliasList,
+		Type:             "Brand",
+		Taxonomy:         taxonomyName,
+		Aliases:          aliasList,
+		BroaderUUIDs:     broaderUUIDs,
+		IsDeprecated:     tmeTerm.Enabled != nil && !*tmeTerm.Enabled,
+		CreatedDate:      normaliseTmeDate(tmeTerm.CreatedDate),
+		LastModifiedDate: normaliseTmeDate(tmeTerm.LastModifiedDate),
+		Uncurated:        true,
+	}
+}
+
+// tmeUUID - the UUID of the brand with the given TME identifier, taking the UUID overrides into account
+func tmeUUID(tmeIdentifier string, uuidOverrides map[string]string) string {
+	if val, ok := uuidOverrides[tmeIdentifier]; ok {
+		return val
+	}
+	return uuid.NewMD5(uuid.UUID{}, []byte(tmeIdentifier)).String()
+}
+
+// normaliseTmeDate - convert a TME timestamp to RFC3339 in UTC, or empty if it can't be parsed
+func normaliseTmeDate(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	for _, layout := range tmeDateLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
 	}
+	log.Warnf("Ignoring TME date [%s] in unknown format", raw)
+	return ""
 }
 
 func buildTmeIdentifier(rawID string, tmeTermTaxonomyName string) string {
@@ -23,7 +23,7 @@ func TestTransformBrandWithUUIDisInStaticMap(t *testing.T) {
 	}
 	brandTaxonomy := "Brands"
 
-	tfp := transformBrand(testTerm, brandTaxonomy)
+	tfp := transformBrand(testTerm, brandTaxonomy, berthaUUIDmap())
 	assert.EqualValues(t, []string{"0312776d-bac4-3118-bc76-b93b2cd3f1ba", "fd4459b2-cc4e-4ec8-9853-c5238eb860fb"}, tfp.AlternativeIdentifiers.UUIDs)
 	assert.Equal(t, "fd4459b2-cc4e-4ec8-9853-c5238eb860fb", tfp.UUID)
 }
@@ -38,7 +38,7 @@ func TestTransformBrand(t *testing.T) {
 				{Name: "b"},
 			}},
 	}
-	tfp := transformBrand(testTerm, taxonomyName)
+	tfp := transformBrand(testTerm, taxonomyName, berthaUUIDmap())
 	log.Infof("got brand %v", tfp)
 	assert.NotNil(t, tfp)
 	assert.EqualValues(t, []string{"B", "b", "Bob"}, tfp.Aliases)
@@ -46,6 +46,36 @@ func TestTransformBrand(t *testing.T) {
 	assert.Equal(t, "Bob", tfp.PrefLabel)
 }
 
+func TestUnMarshallTermWithRelationsAndLifecycle(t *testing.T) {
+	content := []byte(`<term>
+		<name>Business blog</name>
+		<id>Brands_87</id>
+		<enabled>false</enabled>
+		<parent><name>Blogs</name><id>Brands_86</id></parent>
+		<broader><term><name>Blogs</name><id>Brands_86</id></term><term><name>Comment</name><id>comment</id></term></broader>
+		<createdDate>2011-03-15T10:21:37.000+0000</createdDate>
+		<lastModifiedDate>2016-09-01T08:00:00Z</lastModifiedDate>
+	</term>`)
+
+	tmeTerm, err := new(BrandTransformer).UnMarshallTerm(content)
+	assert.NoError(t, err)
+
+	tfp := transformBrand(tmeTerm.(term), "Brands", berthaUUIDmap())
+	assert.Equal(t, "fd4459b2-cc4e-4ec8-9853-c5238eb860fb", tfp.ParentUUID)
+	assert.EqualValues(t, []string{"fd4459b2-cc4e-4ec8-9853-c5238eb860fb", tmeUUID(buildTmeIdentifier("comment", "Brands"), nil)}, tfp.BroaderUUIDs)
+	assert.True(t, tfp.IsDeprecated)
+	assert.Equal(t, "2011-03-15T10:21:37Z", tfp.CreatedDate)
+	assert.Equal(t, "2016-09-01T08:00:00Z", tfp.LastModifiedDate)
+}
+
+func TestTransformBrandWithoutLifecycle(t *testing.T) {
+	tfp := transformBrand(term{CanonicalName: "Bob", RawID: "bob", CreatedDate: "yesterday"}, "Brands", berthaUUIDmap())
+	assert.Empty(t, tfp.ParentUUID)
+	assert.Empty(t, tfp.BroaderUUIDs)
+	assert.False(t, tfp.IsDeprecated)
+	assert.Empty(t, tfp.CreatedDate)
+}
+
 func TestDeduplication(t *testing.T) {
 	input := []string{"a", "b", "b", "c", "d", "d"}
 	expectedOutput := []string{"a", "b", "c", "d"}
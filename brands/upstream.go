@@ -0,0 +1,121 @@
+package brands
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	tmeDependency    = "TME"
+	berthaDependency = "Bertha"
+
+	// probeResultTTL - how long the result of a probe is reported before the dependency is probed again, so
+	// healthchecks polled often don't request the whole Bertha spreadsheet, or hit TME, every time
+	probeResultTTL = 30 * time.Second
+)
+
+// UpstreamProbe - actively checks an upstream dependency can be reached, and that it accepts our credentials
+type UpstreamProbe struct {
+	dependency string
+	taxonomy   string
+	client     httpClient
+	newRequest func() (*http.Request, error)
+	path       string
+
+	sync.Mutex
+	probed  time.Time
+	latency time.Duration
+	err     error
+}
+
+// NewTmeProbe - probe TME by requesting a single term of the taxonomy with the configured credentials
+func NewTmeProbe(client httpClient, tmeBaseURL string, username string, password string, token string, taxonomyName string) *UpstreamProbe {
+	return &UpstreamProbe{
+		dependency: tmeDependency,
+		taxonomy:   taxonomyName,
+		client:     client,
+		newRequest: func() (*http.Request, error) {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/rs/authorityfiles/GL/%s/terms?maximumRecords=1&startRecord=0", tmeBaseURL, taxonomyName), nil)
+			if err != nil {
+				return nil, err
+			}
+			req.SetBasicAuth(username, password)
+			req.Header.Add("Token", token)
+			req.Header.Add("Accept", "application/xml;charset=utf-8")
+			return req, nil
+		},
+	}
+}
+
+// NewBerthaProbe - probe the Bertha URL, or check the curated brands file exists when it is a local file
+func NewBerthaProbe(client httpClient, berthaURL string) *UpstreamProbe {
+	if !isHTTPSource(berthaURL) {
+		return &UpstreamProbe{dependency: berthaDependency, path: berthaURL}
+	}
+	return &UpstreamProbe{
+		dependency: berthaDependency,
+		client:     client,
+		newRequest: func() (*http.Request, error) {
+			return http.NewRequest("GET", berthaURL, nil)
+		},
+	}
+}
+
+// probe - check the dependency, returning how long it took, or the result of the last check if it was recent
+func (p *UpstreamProbe) probe() (time.Duration, error) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.probed.IsZero() && time.Since(p.probed) < probeResultTTL {
+		return p.latency, p.err
+	}
+	p.latency, p.err = p.check()
+	p.probed = time.Now()
+	return p.latency, p.err
+}
+
+func (p *UpstreamProbe) check() (time.Duration, error) {
+	start := time.Now()
+	if p.newRequest == nil {
+		_, err := os.Stat(p.path)
+		return time.Since(start), err
+	}
+
+	req, err := p.newRequest()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := p.client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return latency, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return latency, fmt.Errorf("%s rejected our credentials with status %d", p.dependency, resp.StatusCode)
+	default:
+		return latency, fmt.Errorf("%s responded with status %d", p.dependency, resp.StatusCode)
+	}
+}
+
+func (s *brandServiceImpl) getLastFetch(dependency string) (time.Time, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	fetched, found := s.lastFetches[dependency]
+	return fetched, found
+}
+
+func (s *brandServiceImpl) recordFetch(dependency string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.lastFetches == nil {
+		s.lastFetches = make(map[string]time.Time)
+	}
+	s.lastFetches[dependency] = time.Now().UTC()
+}
@@ -0,0 +1,101 @@
+package brands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTmeProbeSendsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, ok := req.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "secret", password)
+		assert.Equal(t, "token", req.Header.Get("Token"))
+		assert.Equal(t, "/rs/authorityfiles/GL/Brands/terms", req.URL.Path)
+		assert.Equal(t, "1", req.URL.Query().Get("maximumRecords"))
+	}))
+	defer server.Close()
+
+	_, err := NewTmeProbe(http.DefaultClient, server.URL, "user", "secret", "token", "Brands").probe()
+	assert.NoError(t, err)
+}
+
+func TestTmeProbeRejectedCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewTmeProbe(http.DefaultClient, server.URL, "user", "wrong", "token", "Brands").probe()
+	assert.EqualError(t, err, "TME rejected our credentials with status 401")
+}
+
+func TestBerthaProbeUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewBerthaProbe(http.DefaultClient, server.URL).probe()
+	assert.EqualError(t, err, "Bertha responded with status 503")
+}
+
+func TestBerthaProbeLocalFile(t *testing.T) {
+	tmpfile := writeTempSource(t, ".json", "[]")
+	defer os.Remove(tmpfile)
+
+	_, err := NewBerthaProbe(http.DefaultClient, tmpfile).probe()
+	assert.NoError(t, err)
+	_, err = NewBerthaProbe(http.DefaultClient, tmpfile+".missing").probe()
+	assert.Error(t, err)
+}
+
+func TestUpstreamHealthCheckReportsLastFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	fetched := time.Date(2016, 10, 18, 15, 58, 0, 0, time.UTC)
+	handler := NewBrandHandler(&dummyService{lastFetches: map[string]time.Time{berthaDependency: fetched}})
+
+	output, err := handler.BerthaHealthCheck(NewBerthaProbe(http.DefaultClient, server.URL)).Checker()
+	assert.NoError(t, err)
+	assert.Regexp(t, "^Bertha responded in .+\\. Last successful fetch: 2016-10-18T15:58:00Z$", output)
+
+	server.Close()
+	_, err = handler.TmeHealthCheck(NewTmeProbe(http.DefaultClient, server.URL, "user", "secret", "token", "Brands")).Checker()
+	assert.Regexp(t, "^TME probe failed after .+\\. Last successful fetch: never$", err.Error())
+}
+
+func TestProbeResultIsReused(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	probe := NewBerthaProbe(http.DefaultClient, server.URL)
+	_, err := probe.probe()
+	assert.NoError(t, err)
+	_, err = probe.probe()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests, "A recent probe's result is reported without probing again")
+
+	probe.probed = probe.probed.Add(-probeResultTTL)
+	server.Close()
+	_, err = probe.probe()
+	assert.Error(t, err)
+	_, err = probe.probe()
+	assert.Error(t, err, "A failed probe's result is reused too")
+	assert.Equal(t, 1, requests)
+}
+
+func TestTmeHealthCheckPerTaxonomy(t *testing.T) {
+	handler := NewBrandHandler(&dummyService{})
+	assert.Equal(t, "Check connectivity to TME taxonomy Brands", handler.TmeHealthCheck(NewTmeProbe(http.DefaultClient, "http://tme", "user", "secret", "token", "Brands")).Name)
+	assert.Equal(t, "Check connectivity to TME taxonomy Sections", handler.TmeHealthCheck(NewTmeProbe(http.DefaultClient, "http://tme", "user", "secret", "token", "Sections")).Name)
+}
@@ -0,0 +1,122 @@
+package brands
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pborman/uuid"
+)
+
+// loadUUIDOverrides - fetch the TME identifier -> UUID override table from a file path or http(s) URL.
+// An empty source means only the built-in entries from berthaUUIDmap are used.
+func loadUUIDOverrides(ctx context.Context, source string, client httpClient) (map[string]string, error) {
+	if source == "" {
+		return berthaUUIDmap(), nil
+	}
+
+	contents, err := readSource(ctx, source, client)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := parseUUIDOverrides(contents, isCSVSource(source))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse UUID overrides from [%s]: %v", source, err)
+	}
+	return validateUUIDOverrides(overrides)
+}
+
+// readSource - read a file path or http(s) URL, giving up on the request when ctx is done. Gzipped files (*.gz) are decompressed.
+func readSource(ctx context.Context, source string, client httpClient) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !isHTTPSource(source) {
+		if strings.HasSuffix(source, ".gz") {
+			return readGzipped(source)
+		}
+		return ioutil.ReadFile(source)
+	}
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET [%s] returned status %d", source, res.StatusCode)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func isHTTPSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+func isCSVSource(source string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToLower(source), ".gz"), ".csv")
+}
+
+// parseUUIDOverrides - read either a JSON object of TME identifier to UUID, or a CSV with one
+// "tmeIdentifier,uuid" pair per row. A CSV header row is skipped if present.
+func parseUUIDOverrides(contents []byte, isCSV bool) (map[string]string, error) {
+	overrides := make(map[string]string)
+	if !isCSV {
+		err := json.Unmarshal(contents, &overrides)
+		return overrides, err
+	}
+
+	r := csv.NewReader(bytes.NewReader(contents))
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && uuid.Parse(record[1]) == nil {
+			continue
+		}
+		overrides[record[0]] = record[1]
+	}
+	return overrides, nil
+}
+
+// validateUUIDOverrides - check the loaded entries against the built-in map. Built-in entries missing
+// from the loaded table are kept, changed entries are allowed but logged, and invalid UUIDs are rejected.
+func validateUUIDOverrides(overrides map[string]string) (map[string]string, error) {
+	for tmeIdentifier, brandUUID := range overrides {
+		if tmeIdentifier == "" {
+			return nil, fmt.Errorf("UUID override [%s] has no TME identifier", brandUUID)
+		}
+		if uuid.Parse(brandUUID) == nil {
+			return nil, fmt.Errorf("UUID override for [%s] has invalid UUID [%s]", tmeIdentifier, brandUUID)
+		}
+	}
+
+	for tmeIdentifier, builtInUUID := range berthaUUIDmap() {
+		brandUUID, ok := overrides[tmeIdentifier]
+		if !ok {
+			log.Warnf("UUID override for [%s] missing, keeping built-in UUID [%s]", tmeIdentifier, builtInUUID)
+			overrides[tmeIdentifier] = builtInUUID
+		} else if brandUUID != builtInUUID {
+			log.Warnf("UUID override for [%s] changes built-in UUID [%s] to [%s]", tmeIdentifier, builtInUUID, brandUUID)
+		}
+	}
+	return overrides, nil
+}
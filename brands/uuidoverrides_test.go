@@ -0,0 +1,75 @@
+package brands
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadUUIDOverridesDefaultsToBuiltIn(t *testing.T) {
+	overrides, err := loadUUIDOverrides(context.Background(), "", &mockClient{})
+	assert.NoError(t, err)
+	assert.Equal(t, berthaUUIDmap(), overrides)
+}
+
+func TestLoadUUIDOverridesFromJSONFile(t *testing.T) {
+	tmpfile := writeTempSource(t, ".json", `{"Ym9i-QnJhbmRz": "2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11", "QnJhbmRzXzg2-QnJhbmRz": "6aa2d4c5-0a5c-4b1e-9c1d-2e3a4f5b6c7d"}`)
+	defer os.Remove(tmpfile)
+
+	overrides, err := loadUUIDOverrides(context.Background(), tmpfile, &mockClient{})
+	assert.NoError(t, err)
+	assert.Len(t, overrides, len(berthaUUIDmap())+1)
+	assert.Equal(t, "2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11", overrides["Ym9i-QnJhbmRz"])
+	assert.Equal(t, "6aa2d4c5-0a5c-4b1e-9c1d-2e3a4f5b6c7d", overrides["QnJhbmRzXzg2-QnJhbmRz"])
+	assert.Equal(t, "5e5dba2b-8031-4a65-b193-84a58882c62e", overrides["QnJhbmRzXzIwOA==-QnJhbmRz"])
+}
+
+func TestLoadUUIDOverridesFromCSVFile(t *testing.T) {
+	tmpfile := writeTempSource(t, ".csv", "tmeIdentifier,uuid\nYm9i-QnJhbmRz, 2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11\n")
+	defer os.Remove(tmpfile)
+
+	overrides, err := loadUUIDOverrides(context.Background(), tmpfile, &mockClient{})
+	assert.NoError(t, err)
+	assert.Len(t, overrides, len(berthaUUIDmap())+1)
+	assert.Equal(t, "2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11", overrides["Ym9i-QnJhbmRz"])
+}
+
+func TestLoadUUIDOverridesRejectsInvalidUUID(t *testing.T) {
+	tmpfile := writeTempSource(t, ".json", `{"Ym9i-QnJhbmRz": "not-a-uuid"}`)
+	defer os.Remove(tmpfile)
+
+	_, err := loadUUIDOverrides(context.Background(), tmpfile, &mockClient{})
+	assert.Error(t, err)
+}
+
+func TestLoadUUIDOverridesMissingFile(t *testing.T) {
+	_, err := loadUUIDOverrides(context.Background(), "/does/not/exist.json", &mockClient{})
+	assert.Error(t, err)
+}
+
+func TestTransformBrandUsesLoadedOverrides(t *testing.T) {
+	overrides := map[string]string{"Ym9i-QnJhbmRz": "2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11"}
+	tfp := transformBrand(term{CanonicalName: "Bob", RawID: "bob"}, "Brands", overrides)
+	assert.Equal(t, "2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11", tfp.UUID)
+	assert.EqualValues(t, []string{bobUuid, "2b7fc2ad-9fd2-4f58-9b39-6b2d1d3d0a11"}, tfp.AlternativeIdentifiers.UUIDs)
+}
+
+func writeTempSource(t *testing.T, suffix string, contents string) string {
+	tmpfile, err := ioutil.TempFile("", "source")
+	assert.NoError(t, err)
+	assert.NoError(t, tmpfile.Close())
+	name := tmpfile.Name() + suffix
+	assert.NoError(t, os.Rename(tmpfile.Name(), name))
+	assert.NoError(t, ioutil.WriteFile(name, []byte(contents), 0600))
+	return name
+}
+
+func TestReadSourceGivesUpWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := readSource(ctx, "http://bertha/url", &mockClient{})
+	assert.Equal(t, context.Canceled, err)
+}
@@ -1,24 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Financial-Times/base-ft-rw-app-go/baseftrwapp"
 	"github.com/Financial-Times/go-fthealth/v1a"
-	"github.com/Financial-Times/http-handlers-go/httphandlers"
-	"github.com/Financial-Times/service-status-go/gtg"
-	status "github.com/Financial-Times/service-status-go/httphandlers"
 	"github.com/Financial-Times/tme-reader/tmereader"
 	"github.com/Financial-Times/v1-brands-transformer/brands"
 	log "github.com/Sirupsen/logrus"
-	"github.com/gorilla/mux"
 	"github.com/jawher/mow.cli"
-	"github.com/rcrowley/go-metrics"
 	"github.com/sethgrid/pester"
 )
 
@@ -98,85 +97,325 @@ func main() {
 	})
 	berthaSrcURL := app.String(cli.StringOpt{
 		Name:   "bertha-source-url",
-		Desc:   "The URL of the Bertha Brands JSON source",
+		Desc:   "The URL of the Bertha Brands JSON source, or the path of a local JSON or CSV (*.csv) file of curated brands",
 		EnvVar: "BERTHA_SOURCE_URL",
 	})
+	berthaCSVColumns := app.Strings(cli.StringsOpt{
+		Name:   "bertha-csv-columns",
+		Value:  []string{},
+		Desc:   "Comma separated field=header mappings of Bertha fields to the columns of a CSV source, e.g. prefLabel=Brand name. Unmapped fields use the field name as the header",
+		EnvVar: "BERTHA_CSV_COLUMNS",
+	})
 
-	tmeTaxonomyName := "Brands"
+	uuidOverridesSource := app.String(cli.StringOpt{
+		Name:   "uuid-overrides-source",
+		Value:  "",
+		Desc:   "File path or URL of a JSON object or CSV mapping TME identifiers to UUIDs. Leave empty to use the built-in map",
+		EnvVar: "UUID_OVERRIDES_SOURCE",
+	})
+	tmeTaxonomyNames := app.Strings(cli.StringsOpt{
+		Name:   "tme-taxonomies",
+		Value:  []string{"Brands"},
+		Desc:   "Comma separated list of the TME taxonomies to load brands from",
+		EnvVar: "TME_TAXONOMIES",
+	})
+	tmeSourcePath := app.String(cli.StringOpt{
+		Name:   "tme-source-path",
+		Value:  "",
+		Desc:   "Directory or tarball of TME XML dumps, one sub-directory per taxonomy, to load instead of calling TME. Leave empty to use TME",
+		EnvVar: "TME_SOURCE_PATH",
+	})
+	tmePageRetries := app.Int(cli.IntOpt{
+		Name:   "tme-page-retries",
+		Value:  3,
+		Desc:   "Number of times a failed page of TME terms is retried before the reload fails and is left to resume from that page",
+		EnvVar: "TME_PAGE_RETRIES",
+	})
+	tmePageBackoff := app.String(cli.StringOpt{
+		Name:   "tme-page-backoff",
+		Value:  "10s",
+		Desc:   "Initial delay before retrying a failed page of TME terms, doubled on each retry",
+		EnvVar: "TME_PAGE_BACKOFF",
+	})
+	archiveDir := app.String(cli.StringOpt{
+		Name:   "archive-dir",
+		Value:  "",
+		Desc:   "Directory to archive the raw TME and Bertha payloads of each reload in, for audit and replay. Leave empty to disable archiving",
+		EnvVar: "ARCHIVE_DIR",
+	})
+	archiveRetention := app.Int(cli.IntOpt{
+		Name:   "archive-retention",
+		Value:  10,
+		Desc:   "Number of reload archives to keep, 0 to keep them all",
+		EnvVar: "ARCHIVE_RETENTION",
+	})
+	berthaFailurePolicy := app.String(cli.StringOpt{
+		Name:   "bertha-failure-policy",
+		Value:  brands.FailOnBerthaError,
+		Desc:   "What a reload serves when Bertha can't be read: fail (serve nothing), tme-only (serve the TME brands uncurated) or previous-curated (overlay the curated brands of the last successful reload)",
+		EnvVar: "BERTHA_FAILURE_POLICY",
+	})
+	brandValidation := app.String(cli.StringOpt{
+		Name:   "brand-validation",
+		Value:  brands.NoBrandValidation,
+		Desc:   "Whether a reload checks each brand against the schema at /__schema/brand before caching it: off, reject (drop invalid brands) or quarantine (keep invalid brands at /transformers/brands/__quarantine instead of serving them)",
+		EnvVar: "BRAND_VALIDATION",
+	})
+	reloadSLA := app.String(cli.StringOpt{
+		Name:   "reload-sla",
+		Value:  "25h",
+		Desc:   "Maximum age of the last reload that served brands before the data freshness healthcheck fails",
+		EnvVar: "RELOAD_SLA",
+	})
+	maxCountDropPercent := app.Int(cli.IntOpt{
+		Name:   "max-count-drop-percent",
+		Value:  10,
+		Desc:   "Percentage the number of brands may drop by from one reload to the next before the brand count healthcheck fails",
+		EnvVar: "MAX_COUNT_DROP_PERCENT",
+	})
+	maxUncuratedPercent := app.Int(cli.IntOpt{
+		Name:   "max-uncurated-percent",
+		Value:  100,
+		Desc:   "Percentage of brands that may have no curated information from Bertha before the uncurated brands healthcheck fails",
+		EnvVar: "MAX_UNCURATED_PERCENT",
+	})
+	apiKeys := app.Strings(cli.StringsOpt{
+		Name:   "api-keys",
+		Value:  []string{},
+		Desc:   "Comma separated name:key:roles API keys allowed to call the admin endpoints, roles separated by |, e.g. ops:s3cr3t:admin. Callers send the key in the X-Api-Key header",
+		EnvVar: "API_KEYS",
+	})
+	tokenSecret := app.String(cli.StringOpt{
+		Name:   "token-secret",
+		Value:  "",
+		Desc:   "Secret that bearer tokens for the admin endpoints are HMAC-SHA256 signed with",
+		EnvVar: "TOKEN_SECRET",
+	})
+	rateLimits := app.Strings(cli.StringsOpt{
+		Name:   "rate-limits",
+		Value:  brands.DefaultRateLimits,
+		Desc:   "Comma separated route=perClient/global requests a minute, e.g. brands=6/60,reload=1/2, replacing the defaults. Routes are " + strings.Join(brands.RateLimitedRoutes, ", ") + ", any other is rejected. Either side may be left empty for no limit",
+		EnvVar: "RATE_LIMITS",
+	})
+	trustedProxies := app.Strings(cli.StringsOpt{
+		Name:   "trusted-proxies",
+		Value:  []string{},
+		Desc:   "Comma separated addresses or CIDR ranges of the proxies, such as load balancers, trusted to add the address they got a request from to X-Forwarded-For. Without any, clients are told apart by the address of the connection",
+		EnvVar: "TRUSTED_PROXIES",
+	})
+	maxConcurrentStreams := app.Int(cli.IntOpt{
+		Name:   "max-concurrent-streams",
+		Value:  4,
+		Desc:   "Maximum number of full listings (brands, ids and concordances) streamed at once, 0 for no limit",
+		EnvVar: "MAX_CONCURRENT_STREAMS",
+	})
+	shutdownDelay := app.String(cli.StringOpt{
+		Name:   "shutdown-delay",
+		Value:  "0s",
+		Desc:   "How long to keep serving, not good to go, after SIGTERM or SIGINT so load balancers can stop routing to the service",
+		EnvVar: "SHUTDOWN_DELAY",
+	})
+	shutdownTimeout := app.String(cli.StringOpt{
+		Name:   "shutdown-timeout",
+		Value:  "30s",
+		Desc:   "How long to wait on shutdown for streaming responses to finish and a running reload to stop before exiting regardless",
+		EnvVar: "SHUTDOWN_TIMEOUT",
+	})
+	traceExporter := app.String(cli.StringOpt{
+		Name:   "trace-exporter",
+		Value:  brands.NoTraceExporter,
+		Desc:   "Where to export traces of reloads and requests: none, otlp (configured by the standard OTEL_EXPORTER_OTLP_* environment variables) or stdout",
+		EnvVar: "TRACE_EXPORTER",
+	})
 
 	app.Action = func() {
 		baseftrwapp.OutputMetricsIfRequired(*graphiteTCPAddress, *graphitePrefix, *logMetrics)
 		client := getResilientClient()
-		modelTransformer := new(brands.BrandTransformer)
-		s := brands.NewBrandService(
-			tmereader.NewTmeRepository(
-				client,
-				*tmeBaseURL,
-				*username,
-				*password,
-				*token,
-				*maxRecords,
-				*batchSize,
-				tmeTaxonomyName,
-				&tmereader.AuthorityFiles{},
-				modelTransformer),
-			*baseURL,
-			tmeTaxonomyName,
-			*maxRecords,
-			*cacheFileName,
-			*berthaSrcURL,
-			client)
-		defer s.Shutdown()
+		tmeClient := getTmeClient()
+		if *archiveRetention < 0 {
+			log.Fatalf("Invalid archive-retention %d, expected 0 or more", *archiveRetention)
+		}
+		archive := brands.NewPayloadArchive(*archiveDir, *archiveRetention)
+		pageBackoff, err := time.ParseDuration(*tmePageBackoff)
+		if err != nil {
+			log.Fatalf("Invalid tme-page-backoff [%s]: %v", *tmePageBackoff, err)
+		}
+		sla, err := time.ParseDuration(*reloadSLA)
+		if err != nil {
+			log.Fatalf("Invalid reload-sla [%s]: %v", *reloadSLA, err)
+		}
+		drainDelay, err := time.ParseDuration(*shutdownDelay)
+		if err != nil {
+			log.Fatalf("Invalid shutdown-delay [%s]: %v", *shutdownDelay, err)
+		}
+		drainTimeout, err := time.ParseDuration(*shutdownTimeout)
+		if err != nil {
+			log.Fatalf("Invalid shutdown-timeout [%s]: %v", *shutdownTimeout, err)
+		}
+		stopTracing, err := brands.InitTracing(context.Background(), *traceExporter, "v1-brands-transformer")
+		if err != nil {
+			log.Fatalf("Invalid trace-exporter: %v", err)
+		}
+		if len(*tmeTaxonomyNames) == 0 {
+			log.Fatalf("Invalid tme-taxonomies, expected at least one TME taxonomy to load brands from")
+		}
+		for _, tmeTaxonomyName := range *tmeTaxonomyNames {
+			if strings.TrimSpace(tmeTaxonomyName) == "" {
+				log.Fatalf("Invalid tme-taxonomies %v, expected comma separated TME taxonomy names", *tmeTaxonomyNames)
+			}
+		}
+		if !brands.ValidBerthaFailurePolicy(*berthaFailurePolicy) {
+			log.Fatalf("Invalid bertha-failure-policy [%s]", *berthaFailurePolicy)
+		}
+		if !brands.ValidBrandValidation(*brandValidation) {
+			log.Fatalf("Invalid brand-validation [%s]", *brandValidation)
+		}
+		auth, err := brands.NewAuthenticator(*apiKeys, *tokenSecret)
+		if err != nil {
+			log.Fatalf("Invalid api-keys: %v", err)
+		}
+		limits, err := brands.ParseRateLimits(*rateLimits)
+		if err != nil {
+			log.Fatalf("Invalid rate-limits: %v", err)
+		}
+		limiter := brands.NewRateLimiter(limits, *maxConcurrentStreams)
+		proxies, err := brands.ParseTrustedProxies(*trustedProxies)
+		if err != nil {
+			log.Fatalf("Invalid trusted-proxies: %v", err)
+		}
+		columns := make(map[string]string)
+		for _, mapping := range *berthaCSVColumns {
+			parts := strings.SplitN(mapping, "=", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Invalid bertha-csv-columns mapping [%s], expected field=header", mapping)
+			}
+			columns[parts[0]] = parts[1]
+		}
+		var taxonomies []brands.TmeTaxonomy
+		for _, tmeTaxonomyName := range *tmeTaxonomyNames {
+			modelTransformer := brands.NewArchivingBrandTransformer(archive, tmeTaxonomyName)
+			var repository tmereader.Repository
+			if *tmeSourcePath != "" {
+				repository = brands.NewFileTmeRepository(*tmeSourcePath, tmeTaxonomyName, *maxRecords, modelTransformer)
+			} else {
+				repository = tmereader.NewTmeRepository(
+					tmeClient,
+					*tmeBaseURL,
+					*username,
+					*password,
+					*token,
+					*maxRecords,
+					*batchSize,
+					tmeTaxonomyName,
+					&tmereader.AuthorityFiles{},
+					modelTransformer)
+			}
+			taxonomies = append(taxonomies, brands.TmeTaxonomy{Name: tmeTaxonomyName, Repository: repository})
+		}
+		s := brands.NewBrandService(brands.ServiceConfig{
+			Taxonomies:          taxonomies,
+			BaseURL:             *baseURL,
+			MaxTmeRecords:       *maxRecords,
+			CacheFileName:       *cacheFileName,
+			BerthaURL:           *berthaSrcURL,
+			BerthaCSVColumns:    columns,
+			UUIDOverridesSource: *uuidOverridesSource,
+			Archive:             archive,
+			PageRetryPolicy:     brands.RetryPolicy{MaxRetries: *tmePageRetries, Backoff: pageBackoff},
+			BerthaFailurePolicy: *berthaFailurePolicy,
+			BrandValidation:     *brandValidation,
+			HTTPClient:          client,
+		})
 		handler := brands.NewBrandHandler(s)
-		router(handler)
+		probeClient := &http.Client{Timeout: 10 * time.Second}
+		healthChecks := []v1a.Check{
+			handler.HealthCheck(),
+			handler.ReloadHealthCheck(),
+			handler.BerthaHealthCheck(brands.NewBerthaProbe(probeClient, *berthaSrcURL)),
+		}
+		if *tmeSourcePath == "" {
+			for _, tmeTaxonomyName := range *tmeTaxonomyNames {
+				healthChecks = append(healthChecks, handler.TmeHealthCheck(brands.NewTmeProbe(probeClient, *tmeBaseURL, *username, *password, *token, tmeTaxonomyName)))
+			}
+		}
+		thresholds := brands.DataQualityThresholds{ReloadSLA: sla, MaxCountDropPercent: float64(*maxCountDropPercent), MaxUncuratedPercent: float64(*maxUncuratedPercent)}
+		healthChecks = append(healthChecks,
+			handler.DataFreshnessHealthCheck(thresholds),
+			handler.BrandCountHealthCheck(thresholds),
+			handler.UncuratedBrandsHealthCheck(thresholds),
+			handler.OrphanParentsHealthCheck(),
+			handler.SkippedBerthaRowsHealthCheck())
+		http.Handle("/", brands.NewRouter(handler, auth, limiter, proxies, healthChecks))
 
 		log.Printf("listening on %d", *port)
 		log.Printf("Using bertha-source-url: %v", *berthaSrcURL)
-		err := http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
-		if err != nil {
+		log.Printf("Using tme-taxonomies: %v", *tmeTaxonomyNames)
+		if *tmeSourcePath != "" {
+			log.Printf("Using tme-source-path: %v", *tmeSourcePath)
+		}
+		server := &http.Server{Addr: fmt.Sprintf(":%d", *port)}
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.ListenAndServe()
+		}()
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		select {
+		case err = <-serveErr:
 			log.Errorf("Error by listen and serve: %v", err.Error())
+		case sig := <-signals:
+			log.Infof("Received %v, shutting down", sig)
+		}
+		shutdown(server, s, drainDelay, drainTimeout)
+		if err := stopTracing(context.Background()); err != nil {
+			log.Warnf("Cannot flush the traces: %v", err.Error())
 		}
 	}
 	app.Run(os.Args)
 }
 
-func router(handler brands.BrandHandler) {
-	servicesRouter := mux.NewRouter()
-
-	getBrandsSubrouter := servicesRouter.Path("/transformers/brands").Subrouter()
-	getBrandsSubrouter.Methods("GET").HandlerFunc(handler.GetBrands)
-	getBrandsSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
-
-	brandCountSubrouter := servicesRouter.Path("/transformers/brands/__count").Subrouter()
-	brandCountSubrouter.Methods("GET").HandlerFunc(handler.GetCount)
-	brandCountSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
-
-	brandIDsSubrouter := servicesRouter.Path("/transformers/brands/__ids").Subrouter()
-	brandIDsSubrouter.Methods("GET").HandlerFunc(handler.GetBrandUUIDs)
-	brandIDsSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
-
-	brandByUUIDSubrouter := servicesRouter.Path("/transformers/brands/{uuid:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}}").Subrouter()
-	brandByUUIDSubrouter.Methods("GET").HandlerFunc(handler.GetBrandByUUID)
-	brandByUUIDSubrouter.NewRoute().HandlerFunc(handler.OnlyGetAllowed)
-
-	reloadSubrouter := servicesRouter.Path("/transformers/brands/__reload").Subrouter()
-	reloadSubrouter.Methods("POST").HandlerFunc(handler.Reload)
-	reloadSubrouter.NewRoute().HandlerFunc(handler.OnlyPostAllowed)
+// shutdown - stop reloads and go not good to go, keep serving for the delay, then drain the responses in flight and close the cache within the timeout.
+// Responses still streaming after the timeout are cut off, and the cache is closed within a second timeout once they have let go of it.
+func shutdown(server *http.Server, s brands.BrandService, delay time.Duration, timeout time.Duration) {
+	s.StopReloads()
+	time.Sleep(delay)
 
-	var monitoringRouter http.Handler = servicesRouter
-	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(log.StandardLogger(), monitoringRouter)
-	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
-
-	http.HandleFunc(status.PingPath, status.PingHandler)
-	http.HandleFunc(status.PingPathDW, status.PingHandler)
-	http.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
-	http.HandleFunc(status.BuildInfoPathDW, status.BuildInfoHandler)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Responses still in flight after %v are cut off: %v", timeout, err.Error())
+		if err := server.Close(); err != nil {
+			log.Warnf("Error closing the connections: %v", err.Error())
+		}
+	}
 
-	http.HandleFunc("/__health", v1a.Handler("V1 Brands Transformer Healthchecks", "Checks for the health of the service", handler.HealthCheck()))
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.Shutdown()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			log.Errorf("Error closing the cache: %v", err.Error())
+		}
+	case <-time.After(timeout):
+		log.Warnf("Cache still in use by a reload or a stream after %v, exiting without closing it. The next reload resumes from its last written page", timeout)
+	}
+}
 
-	g2gHandler := status.NewGoodToGoHandler(gtg.StatusChecker(handler.G2GCheck))
-	http.HandleFunc(status.GTGPath, g2gHandler)
-	http.Handle("/", monitoringRouter)
+// getTmeClient - a client that doesn't retry, as failed pages of TME terms are retried by the tme-page-retries policy
+func getTmeClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: 32,
+			Dial: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).Dial,
+		},
+		Timeout: 30 * time.Second,
+	}
 }
 
 func getResilientClient() *pester.Client {